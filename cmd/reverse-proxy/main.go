@@ -5,6 +5,9 @@ import (
 	"context"
 	"flag"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/sund3RRR/crafty-reverse-proxy/config"
 	"github.com/sund3RRR/crafty-reverse-proxy/internal/adapters/crafty"
@@ -13,7 +16,8 @@ import (
 )
 
 func main() {
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	configPath := "config/config.yaml"
 
@@ -28,7 +32,10 @@ func main() {
 
 	logger := logger.New(cfg.LogLevel)
 
-	crafty := crafty.New(cfg)
+	crafty, err := crafty.New(cfg)
+	if err != nil {
+		log.Fatal("Failed to create Crafty client, err:", err)
+	}
 	reverseProxyApp := app.New(cfg, logger, crafty)
 
 	reverseProxyApp.Run(ctx)
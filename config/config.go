@@ -2,31 +2,178 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// Environment variables overriding the Crafty credentials from the config file.
+const (
+	// EnvPassword overrides the password for Crafty API authentication.
+	EnvPassword = "CRAFTY_PASSWORD"
+	// EnvAPIToken overrides the Crafty API token.
+	EnvAPIToken = "CRAFTY_API_TOKEN"
+)
+
+// ErrInvalidConfig is returned when the configuration contains a value the proxy cannot work with.
+var ErrInvalidConfig = errors.New("invalid config")
+
+// Auto shutdown modes.
+const (
+	// ShutdownModeConnections shuts a server down once no player connected through the proxy is left.
+	ShutdownModeConnections = "connections"
+	// ShutdownModePlayers shuts a server down once its in-game player count has been zero for the timeout.
+	ShutdownModePlayers = "players"
+)
+
+// Strategies spreading players over the backends of an address.
+const (
+	// StrategyFirstAvailable sends players to the first running backend in the configured order.
+	StrategyFirstAvailable = "first-available"
+	// StrategyRoundRobin sends players to the running backends in turn.
+	StrategyRoundRobin = "round-robin"
+	// StrategyLeastConnections sends players to the running backend with the fewest connections.
+	StrategyLeastConnections = "least-connections"
+)
+
 // Config represents the main configuration for the application.
 type Config struct {
-	APIURL       string        `yaml:"api_url"`       // Base URL for the Crafty API
-	Username     string        `yaml:"username"`      // Username for Crafty API authentication
-	Password     string        `yaml:"password"`      // Password for Crafty API authentication
-	LogLevel     string        `yaml:"log_level"`     // Logging level (e.g., DEBUG, INFO, ERROR)
-	Timeout      time.Duration `yaml:"timeout"`       // Global timeout for API requests
-	AutoShutdown bool          `yaml:"auto_shutdown"` // Whether to automatically shut down idle servers
-	Addresses    []ServerType  `yaml:"addresses"`     // List of server connection configurations
+	APIURL            string        `yaml:"api_url"`              // Base URL for the Crafty API
+	Username          string        `yaml:"username"`             // Username for Crafty API authentication
+	Password          string        `yaml:"password"`             // Password for Crafty API authentication
+	PasswordFile      string        `yaml:"password_file"`        // File containing the password, e.g. a Docker secret
+	APIToken          string        `yaml:"api_token"`            // Crafty API token, used instead of username and password
+	APITokenFile      string        `yaml:"api_token_file"`       // File containing the Crafty API token, e.g. a Docker secret
+	TLS               TLS           `yaml:"tls"`                  // TLS settings of the Crafty API connection
+	RequestTimeout    time.Duration `yaml:"request_timeout"`      // Timeout of a single Crafty API request
+	RequestRetries    int           `yaml:"request_retries"`      // Retries of idempotent Crafty API requests
+	RetryBackoff      time.Duration `yaml:"retry_backoff"`        // Delay before the first retry, doubled on every further retry
+	LogLevel          string        `yaml:"log_level"`            // Logging level (e.g., DEBUG, INFO, ERROR)
+	Timeout           time.Duration `yaml:"timeout"`              // Global timeout for API requests
+	AutoShutdown      bool          `yaml:"auto_shutdown"`        // Whether to automatically shut down idle servers
+	ShutdownMode      string        `yaml:"shutdown_mode"`        // What makes a server idle: "connections" or "players"
+	IdleCheckInterval time.Duration `yaml:"idle_check_interval"`  // Interval of polling the in-game player count in "players" mode
+	ReconcileInterval time.Duration `yaml:"reconcile_interval"`   // Interval of syncing the server state from Crafty, 0 to disable
+	DrainTimeout      time.Duration `yaml:"drain_timeout"`        // Time active sessions may keep running after a shutdown signal
+	StopServersOnExit bool          `yaml:"stop_servers_on_exit"` // Whether to stop the Minecraft servers when the proxy exits
+	Addresses         []ServerType  `yaml:"addresses"`            // List of server connection configurations
+	Metrics           Metrics       `yaml:"metrics"`              // Prometheus metrics endpoint
+	Admin             Admin         `yaml:"admin"`                // Admin HTTP API
+}
+
+// TLS defines how the Crafty API certificate is verified and which client certificate is presented.
+type TLS struct {
+	CAFile             string `yaml:"ca_file"`              // PEM bundle of CAs trusted in addition to the system roots
+	PinnedSHA256       string `yaml:"pinned_sha256"`        // SHA-256 fingerprint of the Crafty certificate, replaces CA verification
+	CertFile           string `yaml:"cert_file"`            // PEM client certificate for mutual TLS
+	KeyFile            string `yaml:"key_file"`             // PEM private key of the client certificate
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // Accept any certificate, for testing only
+}
+
+// Admin defines the authenticated HTTP API for inspecting and controlling the Minecraft servers.
+type Admin struct {
+	Enabled  bool   `yaml:"enabled"`  // Whether to serve the admin API
+	Listener Host   `yaml:"listener"` // Address and port of the admin API
+	Token    string `yaml:"token"`    // Bearer token required by every request
+}
+
+// Metrics defines the HTTP endpoint exposing Prometheus metrics.
+type Metrics struct {
+	Enabled  bool `yaml:"enabled"`  // Whether to serve the /metrics endpoint
+	Listener Host `yaml:"listener"` // Address and port of the metrics endpoint
 }
 
 // ServerType defines the network parameters and mapping between a listener and a Crafty server.
 type ServerType struct {
-	Protocol   string `yaml:"protocol"`    // Network protocol used (e.g., tcp, udp)
-	Listener   Host   `yaml:"listener"`    // Address and port the proxy listens on
-	CraftyHost Host   `yaml:"crafty_host"` // Corresponding Crafty server address and port
+	Protocol            string        `yaml:"protocol"`              // Network protocol used (e.g., tcp, udp)
+	Listener            Host          `yaml:"listener"`              // Address and port the proxy listens on
+	Hostnames           []string      `yaml:"hostnames"`             // Hostnames routed to this server, "*.example.com" wildcards allowed
+	CraftyHost          Host          `yaml:"crafty_host"`           // Corresponding Crafty server address and port
+	CraftyServer        CraftyServer  `yaml:"crafty_server"`         // Crafty server to control, looked up by crafty_host port if empty
+	Status              Status        `yaml:"status"`                // Server list status served by the proxy while the server is not available
+	Login               Login         `yaml:"login"`                 // Login handling while the server is not available
+	ProxyProtocol       string        `yaml:"proxy_protocol"`        // PROXY protocol version sent to the server ("v1", "v2" or empty to disable)
+	AcceptProxyProtocol bool          `yaml:"accept_proxy_protocol"` // Require a PROXY protocol header from clients (v1 or v2)
+	SessionTimeout      time.Duration `yaml:"session_timeout"`       // Idle time after which a UDP session is closed
+	ReadyAfter          time.Duration `yaml:"ready_after"`           // Time the server must keep answering status pings before players are let in
+	RCON                RCON          `yaml:"rcon"`                  // RCON access used to warn players and save the world before a stop
+	Backends            []Backend     `yaml:"backends"`              // Further servers behind the address, started only if crafty_host fails to come up
+	Strategy            string        `yaml:"strategy"`              // How players are spread over running backends: "first-available", "round-robin" or "least-connections"
+}
+
+// Backend defines a further Minecraft server behind an address, e.g. a lobby replica or a fallback server.
+// It shares the listener, status and login settings of the address.
+type Backend struct {
+	CraftyHost   Host         `yaml:"crafty_host"`   // Crafty server address and port
+	CraftyServer CraftyServer `yaml:"crafty_server"` // Crafty server to control, looked up by crafty_host port if empty
+	RCON         RCON         `yaml:"rcon"`          // RCON access used to warn players and save the world before a stop
+}
+
+// RCON defines the RCON connection to a Minecraft server and the commands run before it is stopped.
+type RCON struct {
+	Enabled         bool            `yaml:"enabled"`           // Whether to use RCON before stopping the server
+	Host            Host            `yaml:"host"`              // RCON address and port (rcon.port in server.properties)
+	Password        string          `yaml:"password"`          // RCON password (rcon.password in server.properties)
+	Countdown       []time.Duration `yaml:"countdown"`         // Times before a stop at which players online are warned
+	WarningMessage  string          `yaml:"warning_message"`   // Warning broadcast with "say", %s is replaced by the remaining time
+	PreStopCommands []string        `yaml:"pre_stop_commands"` // Commands run right before the stop, followed by save-all
+}
+
+// CraftyServer pins the server in the Crafty panel that is started and stopped for an address.
+// The ID takes precedence over the name.
+type CraftyServer struct {
+	ID   string `yaml:"id"`   // Crafty server ID (UUID)
+	Name string `yaml:"name"` // Crafty server name
+}
+
+// Login defines how the proxy treats players joining a server that is not running yet.
+type Login struct {
+	KickWhileStarting bool   `yaml:"kick_while_starting"` // Disconnect joining players with a message while the server starts
+	StartingMessage   string `yaml:"starting_message"`    // Disconnect reason, '&' colour codes or a JSON chat component
+	StoppingMessage   string `yaml:"stopping_message"`    // Disconnect reason while the server stops before starting again
+	CrashedMessage    string `yaml:"crashed_message"`     // Disconnect reason while a crashed server is not started again
+	JoinThreshold     int    `yaml:"join_threshold"`      // Bytes an encrypted login session must receive before the player counts as joined
+}
+
+// Status defines how the proxy answers server list pings on behalf of the Minecraft server.
+type Status struct {
+	MaxPlayers int         `yaml:"max_players"` // Max players value shown in the server list
+	Favicon    string      `yaml:"favicon"`     // Path to a 64x64 PNG server icon
+	Off        StateStatus `yaml:"off"`         // Status shown while the server is off
+	StartingUp StateStatus `yaml:"starting_up"` // Status shown while the server is starting
+	Empty      StateStatus `yaml:"empty"`       // Status shown while the server is running without players
+}
+
+// StateStatus defines the server list entry shown for a particular server state.
+type StateStatus struct {
+	MOTD        string `yaml:"motd"`         // MOTD text, '&' colour codes or a JSON chat component
+	VersionName string `yaml:"version_name"` // Version label shown in the server list
+}
+
+// ListenerKey identifies the listener of the server type.
+// Server types sharing a listener key are served by a single listener and routed by hostname.
+func (s ServerType) ListenerKey() string {
+	return fmt.Sprintf("%s://%s:%d", s.Protocol, s.Listener.Addr, s.Listener.Port)
+}
+
+// BackendTypes returns the server types of all backends of the address, starting with crafty_host itself.
+func (s ServerType) BackendTypes() []ServerType {
+	types := []ServerType{s}
+	for _, backend := range s.Backends {
+		backendType := s
+		backendType.CraftyHost = backend.CraftyHost
+		backendType.CraftyServer = backend.CraftyServer
+		backendType.RCON = backend.RCON
+		backendType.Backends = nil
+		types = append(types, backendType)
+	}
+	return types
 }
 
 // Host defines a network address and port pair.
@@ -35,15 +182,40 @@ type Host struct {
 	Port int    `yaml:"port"` // Port number
 }
 
+// String returns the host in addr:port form.
+func (h Host) String() string {
+	return fmt.Sprintf("%s:%d", h.Addr, h.Port)
+}
+
 // NewConfig returns a Config instance populated with default values.
 func NewConfig() Config {
 	return Config{
-		APIURL:       "https://crafty:8443",
-		Username:     "admin",
-		Password:     "password",
-		LogLevel:     "INFO",
-		Timeout:      time.Minute * 5,
-		AutoShutdown: true,
+		APIURL:            "https://crafty:8443",
+		Username:          "admin",
+		Password:          "password",
+		RequestTimeout:    10 * time.Second,
+		RequestRetries:    3,
+		RetryBackoff:      500 * time.Millisecond,
+		LogLevel:          "INFO",
+		Timeout:           time.Minute * 5,
+		AutoShutdown:      true,
+		ShutdownMode:      ShutdownModeConnections,
+		IdleCheckInterval: 15 * time.Second,
+		DrainTimeout:      30 * time.Second,
+		Metrics: Metrics{
+			Enabled: false,
+			Listener: Host{
+				Addr: "0.0.0.0",
+				Port: 9100,
+			},
+		},
+		Admin: Admin{
+			Enabled: false,
+			Listener: Host{
+				Addr: "127.0.0.1",
+				Port: 8080,
+			},
+		},
 		Addresses: []ServerType{
 			{
 				Protocol: "tcp",
@@ -55,6 +227,21 @@ func NewConfig() Config {
 					Addr: "crafty",
 					Port: 25565,
 				},
+				Status: Status{
+					MaxPlayers: 20,
+					Off: StateStatus{
+						MOTD:        "&7Server is sleeping. &aJoin to start it!",
+						VersionName: "Sleeping - join to wake",
+					},
+					StartingUp: StateStatus{
+						MOTD:        "&eServer is starting, please wait...",
+						VersionName: "Starting...",
+					},
+				},
+				Login: Login{
+					KickWhileStarting: true,
+					StartingMessage:   "&eServer is starting, retry in ~45s",
+				},
 			},
 		},
 	}
@@ -78,7 +265,7 @@ func (c *Config) Load(path string) error {
 			}
 
 			log.Printf("config file not found — created default at %s\n", path)
-			return nil
+			return c.finish()
 		}
 
 		return fmt.Errorf("could not open config file: %w", err)
@@ -94,5 +281,77 @@ func (c *Config) Load(path string) error {
 		return fmt.Errorf("could not parse yaml config: %w", err)
 	}
 
+	return c.finish()
+}
+
+// finish resolves the secrets of a loaded configuration and validates it.
+func (c *Config) finish() error {
+	if err := c.resolveSecrets(); err != nil {
+		return err
+	}
+	return c.validate()
+}
+
+// validate rejects settings that would make the proxy fail or silently misbehave at runtime.
+func (c *Config) validate() error {
+	switch c.ShutdownMode {
+	case ShutdownModeConnections, ShutdownModePlayers:
+	default:
+		return fmt.Errorf("%w: unknown shutdown_mode %q", ErrInvalidConfig, c.ShutdownMode)
+	}
+	if c.ShutdownMode == ShutdownModePlayers && c.IdleCheckInterval <= 0 {
+		return fmt.Errorf("%w: idle_check_interval must be positive, got %s", ErrInvalidConfig, c.IdleCheckInterval)
+	}
+	if c.Admin.Enabled && c.Admin.Token == "" {
+		return fmt.Errorf("%w: admin.token is required when the admin API is enabled", ErrInvalidConfig)
+	}
+	acceptProxyProtocol := make(map[string]bool)
+	for _, address := range c.Addresses {
+		switch address.Strategy {
+		case "", StrategyFirstAvailable, StrategyRoundRobin, StrategyLeastConnections:
+		default:
+			return fmt.Errorf("%w: unknown strategy %q for %s", ErrInvalidConfig, address.Strategy, address.CraftyHost)
+		}
+
+		// The PROXY protocol header is read before the handshake, so before the route is known.
+		key := address.ListenerKey()
+		if accept, ok := acceptProxyProtocol[key]; ok && accept != address.AcceptProxyProtocol {
+			return fmt.Errorf("%w: accept_proxy_protocol differs between addresses on listener %s", ErrInvalidConfig, key)
+		}
+		acceptProxyProtocol[key] = address.AcceptProxyProtocol
+	}
+	return nil
+}
+
+// resolveSecrets fills in the Crafty credentials from environment variables and secret files.
+// A secret file takes precedence over the environment variable, which takes precedence over the inline value.
+func (c *Config) resolveSecrets() error {
+	if value, ok := os.LookupEnv(EnvPassword); ok {
+		c.Password = value
+	}
+	if value, ok := os.LookupEnv(EnvAPIToken); ok {
+		c.APIToken = value
+	}
+
+	var err error
+	if c.Password, err = readSecret(c.PasswordFile, c.Password); err != nil {
+		return fmt.Errorf("could not read password file: %w", err)
+	}
+	if c.APIToken, err = readSecret(c.APITokenFile, c.APIToken); err != nil {
+		return fmt.Errorf("could not read api token file: %w", err)
+	}
+
 	return nil
 }
+
+// readSecret returns the trimmed contents of the file at path, or fallback if path is empty.
+func readSecret(path, fallback string) (string, error) {
+	if path == "" {
+		return fallback, nil
+	}
+	data, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -4,114 +4,201 @@ package crafty
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/sund3RRR/crafty-reverse-proxy/config"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/metrics"
 )
 
-// Crafty is a client for the Crafty API. It provides methods to start and stop Minecraft servers by port.
+// Endpoint names used to label Crafty API request metrics.
+const (
+	endpointLogin       = "login"
+	endpointServers     = "servers"
+	endpointStartServer = "start_server"
+	endpointStopServer  = "stop_server"
+	endpointServerStats = "server_stats"
+)
+
+// statusOK is the status reported by Crafty in successful responses.
+const statusOK = "ok"
+
+// Crafty is a client for the Crafty API. It provides methods to resolve, start and stop Minecraft servers.
+// It is safe for concurrent use; the bearer token is shared by all callers.
+// When an API token is configured it is used as the bearer token and the login flow is skipped.
 type Crafty struct {
 	apiURL   string
 	username string
 	password string
 	client   *http.Client
+	tokens   *tokenManager
+
+	retries      int           // Additional attempts for idempotent requests
+	retryBackoff time.Duration // Delay before the first retry, doubled on every further retry
+
+	mu       sync.Mutex
+	resolved map[string]string // Server IDs looked up by name or port
 }
 
 // New creates a new Crafty API client using the provided configuration.
-func New(cfg config.Config) *Crafty {
-	return &Crafty{
+// It fails if the TLS settings cannot be applied.
+func New(cfg config.Config) (*Crafty, error) {
+	transport, err := newTransport(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Crafty{
 		apiURL:   cfg.APIURL,
 		username: cfg.Username,
 		password: cfg.Password,
-		client:   &http.Client{},
+		client:   &http.Client{Transport: transport, Timeout: cfg.RequestTimeout},
+		resolved: make(map[string]string),
+
+		retries:      cfg.RequestRetries,
+		retryBackoff: cfg.RetryBackoff,
+	}
+	c.tokens = newTokenManager(c.login)
+	if cfg.APIToken != "" {
+		c.tokens = newTokenManager(func(context.Context) (string, error) {
+			return cfg.APIToken, nil
+		})
 	}
+	return c, nil
 }
 
-// StartMcServer starts a Minecraft server that is configured to listen on the specified port.
-// It authenticates with the Crafty API, fetches the list of servers, and sends a start command to the matching one.
-func (c *Crafty) StartMcServer(port int) error {
-	bearer, err := c.getBearer()
-	if err != nil {
-		return fmt.Errorf("%w, %v", ErrAuthorizationFailed, err)
+// ResolveServer returns the Crafty ID of a server. A pinned ID is returned as is; otherwise the server
+// is looked up by name, or by port if no name is given. Lookups are cached for the client's lifetime.
+func (c *Crafty) ResolveServer(ctx context.Context, server config.CraftyServer, port int) (string, error) {
+	if server.ID != "" {
+		return server.ID, nil
+	}
+
+	key := fmt.Sprintf("port:%d", port)
+	if server.Name != "" {
+		key = "name:" + server.Name
+	}
+
+	c.mu.Lock()
+	serverID, cached := c.resolved[key]
+	c.mu.Unlock()
+	if cached {
+		return serverID, nil
 	}
 
-	serverList, err := c.getServers(bearer)
+	serverList, err := c.getServers(ctx)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrFailedToGetServers, err)
+		return "", fmt.Errorf("%w: %w", ErrFailedToGetServers, err)
 	}
 
-	for _, server := range serverList.Data {
-		if server.Port == port {
-			return c.sendStartServerRequest(server, bearer)
+	var matches []Server
+	for _, candidate := range serverList.Data {
+		if (server.Name != "" && candidate.Name == server.Name) || (server.Name == "" && candidate.Port == port) {
+			matches = append(matches, candidate)
 		}
 	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%w: %s", ErrNoSuchServer, key)
+	case 1:
+	default:
+		return "", fmt.Errorf("%w: %d servers match %s", ErrAmbiguousServer, len(matches), key)
+	}
+
+	c.mu.Lock()
+	c.resolved[key] = matches[0].ServerID
+	c.mu.Unlock()
 
-	return ErrNoSuchServer
+	return matches[0].ServerID, nil
 }
 
-// StopMcServer stops a Minecraft server that is configured to listen on the specified port.
-// It authenticates with the Crafty API, fetches the list of servers, and sends a stop command to the matching one.
-func (c *Crafty) StopMcServer(port int) error {
-	bearer, err := c.getBearer()
-	if err != nil {
-		return fmt.Errorf("%w, %v", ErrAuthorizationFailed, err)
-	}
+// StartMcServer starts the Minecraft server with the specified Crafty ID.
+func (c *Crafty) StartMcServer(ctx context.Context, serverID string) error {
+	return c.sendStartServerRequest(ctx, serverID)
+}
 
-	serverList, err := c.getServers(bearer)
-	if err != nil {
-		return fmt.Errorf("%w: %v", ErrFailedToGetServers, err)
-	}
+// StopMcServer stops the Minecraft server with the specified Crafty ID.
+func (c *Crafty) StopMcServer(ctx context.Context, serverID string) error {
+	return c.sendStopServerRequest(ctx, serverID)
+}
 
-	for _, server := range serverList.Data {
-		if server.Port == port {
-			return c.sendStopServerRequest(server, bearer)
+// ServerStats returns the live state of the Minecraft server with the specified Crafty ID.
+func (c *Crafty) ServerStats(ctx context.Context, serverID string) (ServerStats, error) {
+	var stats ServerStatsResponse
+	err := c.retry(ctx, func() error {
+		response, err := c.doAuthorized(ctx, endpointServerStats, http.MethodGet, c.apiURL+"/api/v2/servers/"+serverID+"/stats")
+		if err != nil {
+			return err
+		}
+		return decodeResponse(response, &stats)
+	})
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			c.forget(serverID)
 		}
+		return ServerStats{}, fmt.Errorf("%w, id %s: %w", ErrFailedToGetStats, serverID, err)
 	}
 
-	return ErrNoSuchServer
+	return stats.Data, nil
 }
 
 // sendStartServerRequest sends a start command for the specified server using its ID.
-// Requires a valid bearer token for authentication.
-func (c *Crafty) sendStartServerRequest(server Server, bearer string) error {
-	startServerURL := c.apiURL + "/api/v2/servers/" + server.ServerID + "/action/start_server"
-	request, err := http.NewRequest(http.MethodPost, startServerURL, nil)
-	if err != nil {
-		return err
+// A conflict means the server is already running, which is only known for starts.
+func (c *Crafty) sendStartServerRequest(ctx context.Context, serverID string) error {
+	startServerURL := c.apiURL + "/api/v2/servers/" + serverID + "/action/start_server"
+	err := c.sendAction(ctx, endpointStartServer, serverID, startServerURL)
+	if errors.Is(err, ErrConflict) {
+		err = fmt.Errorf("%w: %w", ErrServerAlreadyRunning, err)
 	}
-
-	request.Header.Add("Authorization", bearer)
-	_, err = c.client.Do(request)
 	if err != nil {
-		return fmt.Errorf("%w, id %s, port %d: %v", ErrFailedToStartServer, server.ServerID, server.Port, err)
+		return fmt.Errorf("%w, id %s: %w", ErrFailedToStartServer, serverID, err)
 	}
-
 	return nil
 }
 
 // sendStopServerRequest sends a stop command for the specified server using its ID.
-// Requires a valid bearer token for authentication.
-func (c *Crafty) sendStopServerRequest(server Server, bearer string) error {
-	stopServerURL := c.apiURL + "/api/v2/servers/" + server.ServerID + "/action/stop_server"
-	request, err := http.NewRequest(http.MethodPost, stopServerURL, nil)
-	if err != nil {
-		return err
+func (c *Crafty) sendStopServerRequest(ctx context.Context, serverID string) error {
+	stopServerURL := c.apiURL + "/api/v2/servers/" + serverID + "/action/stop_server"
+	if err := c.sendAction(ctx, endpointStopServer, serverID, stopServerURL); err != nil {
+		return fmt.Errorf("%w, id %s: %w", ErrFailedToStopServer, serverID, err)
 	}
+	return nil
+}
 
-	request.Header.Add("Authorization", bearer)
-	_, err = c.client.Do(request)
+// sendAction sends a server action and checks Crafty's response.
+// Actions are not idempotent, so they are never retried. A server Crafty does not know is dropped from the lookup cache, so it is resolved again next time.
+func (c *Crafty) sendAction(ctx context.Context, endpoint, serverID, url string) error {
+	response, err := c.doAuthorized(ctx, endpoint, http.MethodPost, url)
 	if err != nil {
-		return fmt.Errorf("%w, id %s, port %d: %v", ErrFailedToStopServer, server.ServerID, server.Port, err)
+		return err
 	}
+	err = decodeResponse(response, nil)
+	if errors.Is(err, ErrNotFound) {
+		c.forget(serverID)
+	}
+	return err
+}
 
-	return nil
+// forget drops every cached lookup resolving to serverID.
+func (c *Crafty) forget(serverID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, resolved := range c.resolved {
+		if resolved == serverID {
+			delete(c.resolved, key)
+		}
+	}
 }
 
-// getBearer authenticates with the Crafty API and returns a bearer token to be used for authorized requests.
-func (c *Crafty) getBearer() (string, error) {
+// login authenticates with the Crafty API and returns the issued token.
+func (c *Crafty) login(ctx context.Context) (string, error) {
 	loginBody := LoginPayload{
 		Username: c.username,
 		Password: c.password,
@@ -122,7 +209,13 @@ func (c *Crafty) getBearer() (string, error) {
 		return "", err
 	}
 
-	resp, err := http.Post(c.apiURL+"/api/v2/auth/login", "application/json", bytes.NewBuffer(jsonData))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL+"/api/v2/auth/login", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(endpointLogin, request)
 	if err != nil {
 		return "", fmt.Errorf("%w: %v", ErrHTTPRequestFailed, err)
 	}
@@ -136,34 +229,97 @@ func (c *Crafty) getBearer() (string, error) {
 	var response LoginResponse
 	err = json.Unmarshal(body, &response)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("%w: status %d: %v", ErrAuthorizationFailed, resp.StatusCode, err)
+	}
+	if response.Status != statusOK || response.Data.Token == "" {
+		return "", fmt.Errorf("%w: status %d, crafty status %q", ErrAuthorizationFailed, resp.StatusCode, response.Status)
 	}
 
-	return fmt.Sprintf("Bearer %s", response.Data.Token), nil
+	return response.Data.Token, nil
 }
 
-// getServers retrieves a list of all servers available in the Crafty panel.
-// Requires a valid bearer token for authentication.
-func (c *Crafty) getServers(bearer string) (ServerList, error) {
-	request, _ := http.NewRequest(http.MethodGet, c.apiURL+"/api/v2/servers", nil)
-	request.Header.Add("Authorization", bearer)
+// doAuthorized sends a request without a body using the cached bearer token.
+// If Crafty rejects the token, it is refreshed and the request is retried once.
+func (c *Crafty) doAuthorized(ctx context.Context, endpoint, method, url string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		token, err := c.tokens.get(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%w, %w", ErrAuthorizationFailed, err)
+		}
 
+		request, err := http.NewRequestWithContext(ctx, method, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Add("Authorization", "Bearer "+token)
+
+		response, err := c.do(endpoint, request)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrHTTPRequestFailed, err)
+		}
+		if response.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return response, nil
+		}
+
+		response.Body.Close()
+		c.tokens.invalidate(token)
+	}
+}
+
+// do sends the request and records its latency under the given endpoint name.
+func (c *Crafty) do(endpoint string, request *http.Request) (*http.Response, error) {
+	started := time.Now()
 	response, err := c.client.Do(request)
+	metrics.CraftyRequestDuration.Observe(time.Since(started).Seconds(), endpoint, metrics.Result(err))
+	return response, err
+}
+
+// getServers retrieves a list of all servers available in the Crafty panel.
+func (c *Crafty) getServers(ctx context.Context) (ServerList, error) {
+	var serverList ServerList
+	err := c.retry(ctx, func() error {
+		response, err := c.doAuthorized(ctx, endpointServers, http.MethodGet, c.apiURL+"/api/v2/servers")
+		if err != nil {
+			return err
+		}
+		return decodeResponse(response, &serverList)
+	})
 	if err != nil {
-		return ServerList{}, fmt.Errorf("%w: %v", ErrHTTPRequestFailed, err)
+		return ServerList{}, err
 	}
+
+	return serverList, nil
+}
+
+// decodeResponse checks the status code and Crafty's error envelope, then decodes the body into v
+// unless v is nil. The response body is always closed.
+func decodeResponse(response *http.Response, v any) error {
 	defer response.Body.Close()
 
-	serversListBody, err := io.ReadAll(response.Body)
+	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		return ServerList{}, fmt.Errorf("%w: %v", ErrFailedToReadBody, err)
+		return fmt.Errorf("%w: %v", ErrFailedToReadBody, err)
 	}
 
-	var serverList ServerList
-	err = json.Unmarshal(serversListBody, &serverList)
-	if err != nil {
-		return ServerList{}, err
+	var envelope ErrorResponse
+	_ = json.Unmarshal(body, &envelope)
+
+	if response.StatusCode >= http.StatusBadRequest || (envelope.Status != "" && envelope.Status != statusOK) {
+		cause, ok := codeErrors[envelope.Error]
+		if !ok {
+			cause, ok = statusErrors[response.StatusCode]
+		}
+		if !ok && response.StatusCode >= http.StatusInternalServerError {
+			cause, ok = ErrUnavailable, true
+		}
+		if !ok {
+			cause = ErrUnexpectedResponse
+		}
+		return fmt.Errorf("%w: status %d, crafty error %q%s", cause, response.StatusCode, envelope.Error, envelope.details())
 	}
 
-	return serverList, nil
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(body, v)
 }
@@ -0,0 +1,110 @@
+package crafty
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/config"
+)
+
+func response(statusCode int, body string) *http.Response {
+	return &http.Response{StatusCode: statusCode, Body: io.NopCloser(strings.NewReader(body))}
+}
+
+func TestDecodeResponseErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		wantErr    error
+		wantDetail string // Text the error message must contain
+	}{
+		{name: "unauthorized", statusCode: http.StatusUnauthorized, body: "", wantErr: ErrUnauthorized},
+		{
+			name:       "forbidden",
+			statusCode: http.StatusForbidden,
+			body:       `{"status":"error","error":"NOT_AUTHORIZED","error_data":"missing COMMANDS permission"}`,
+			wantErr:    ErrForbidden,
+			wantDetail: "missing COMMANDS permission",
+		},
+		{name: "not found", statusCode: http.StatusNotFound, body: `{"status":"error","error":"NOT_FOUND"}`, wantErr: ErrNotFound},
+		{name: "rate limited", statusCode: http.StatusTooManyRequests, body: "Too Many Requests", wantErr: ErrRateLimited},
+		{name: "conflict", statusCode: http.StatusConflict, body: `{"status":"error"}`, wantErr: ErrConflict},
+		{
+			name:       "already running with status 200",
+			statusCode: http.StatusOK,
+			body:       `{"status":"error","error":"SER_RUNNING","error_data":"Server is already running"}`,
+			wantErr:    ErrServerAlreadyRunning,
+			wantDetail: "Server is already running",
+		},
+		{
+			name:       "error envelope with status 200",
+			statusCode: http.StatusOK,
+			body:       `{"status":"error","error":"SOMETHING_ELSE","error_data":{"reason":"unknown"}}`,
+			wantErr:    ErrUnexpectedResponse,
+			wantDetail: `{"reason":"unknown"}`,
+		},
+		{name: "error code over status", statusCode: http.StatusBadRequest, body: `{"status":"error","error":"NOT_FOUND"}`, wantErr: ErrNotFound},
+		{name: "bad request", statusCode: http.StatusBadRequest, body: `{"status":"error","error":"INVALID_JSON"}`, wantErr: ErrUnexpectedResponse},
+		{name: "server error", statusCode: http.StatusBadGateway, body: "<html>Bad Gateway</html>", wantErr: ErrUnavailable},
+	}
+	for _, tt := range tests {
+		err := decodeResponse(response(tt.statusCode, tt.body), nil)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: decodeResponse() error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.wantDetail) {
+			t.Errorf("%s: decodeResponse() error = %q, want it to contain %q", tt.name, err, tt.wantDetail)
+		}
+	}
+}
+
+func TestDecodeResponseSuccess(t *testing.T) {
+	var v struct {
+		Status string `json:"status"`
+		Data   struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	if err := decodeResponse(response(http.StatusOK, `{"status":"ok","data":{"token":"abc"}}`), &v); err != nil {
+		t.Fatalf("decodeResponse() error = %v", err)
+	}
+	if v.Data.Token != "abc" {
+		t.Errorf("decoded token = %q, want %q", v.Data.Token, "abc")
+	}
+
+	// Bodies that are not an envelope are fine as long as nothing is decoded from them.
+	if err := decodeResponse(response(http.StatusOK, "plain text"), nil); err != nil {
+		t.Errorf("decodeResponse() of a plain body error = %v", err)
+	}
+}
+
+func TestActionConflict(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"status":"error"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	c, err := New(config.Config{APIURL: server.URL, APIToken: "token", RequestTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+
+	// Only a start conflicts with a running server.
+	if err := c.StartMcServer(ctx, "server-1"); !errors.Is(err, ErrServerAlreadyRunning) {
+		t.Errorf("StartMcServer() error = %v, want %v", err, ErrServerAlreadyRunning)
+	}
+	err = c.StopMcServer(ctx, "server-1")
+	if !errors.Is(err, ErrConflict) || errors.Is(err, ErrServerAlreadyRunning) {
+		t.Errorf("StopMcServer() error = %v, want %v only", err, ErrConflict)
+	}
+}
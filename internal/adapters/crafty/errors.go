@@ -1,6 +1,9 @@
 package crafty
 
-import "errors"
+import (
+	"errors"
+	"net/http"
+)
 
 var (
 	// ErrHTTPRequestFailed is returned when an HTTP request to the Crafty API fails.
@@ -12,6 +15,9 @@ var (
 	// ErrFailedToGetServers is returned when the server list could not be retrieved from the Crafty API.
 	ErrFailedToGetServers = errors.New("failed to get servers")
 
+	// ErrFailedToGetStats is returned when the stats of a server could not be retrieved from the Crafty API.
+	ErrFailedToGetStats = errors.New("failed to get server stats")
+
 	// ErrFailedToStartServer is returned when a server start request fails.
 	ErrFailedToStartServer = errors.New("failed to start Minecraft server")
 
@@ -21,6 +27,55 @@ var (
 	// ErrAuthorizationFailed is returned when authentication with the Crafty API fails.
 	ErrAuthorizationFailed = errors.New("authorization failed")
 
-	// ErrNoSuchServer is returned when no Minecraft server with the specified port is found.
+	// ErrNoSuchServer is returned when no Minecraft server with the specified name or port is found.
 	ErrNoSuchServer = errors.New("no such server")
+
+	// ErrAmbiguousServer is returned when several Minecraft servers match the specified name or port.
+	ErrAmbiguousServer = errors.New("ambiguous server, pin it by id")
+
+	// ErrInvalidTLSConfig is returned when the TLS settings of the client cannot be applied.
+	ErrInvalidTLSConfig = errors.New("invalid TLS config")
+
+	// ErrCertificateMismatch is returned when the Crafty certificate does not match the pinned fingerprint.
+	ErrCertificateMismatch = errors.New("certificate does not match pinned fingerprint")
+
+	// ErrUnauthorized is returned when Crafty rejects the credentials (HTTP 401).
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrForbidden is returned when the Crafty user lacks the permission for the request (HTTP 403).
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrNotFound is returned when Crafty does not know the requested server (HTTP 404).
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is returned when Crafty rejects an action that conflicts with the server state (HTTP 409).
+	ErrConflict = errors.New("conflict")
+
+	// ErrServerAlreadyRunning is returned when a start is requested for a server that is already running.
+	ErrServerAlreadyRunning = errors.New("server already running")
+
+	// ErrRateLimited is returned when Crafty throttles the client (HTTP 429).
+	ErrRateLimited = errors.New("rate limited")
+
+	// ErrUnavailable is returned when Crafty fails with a server error (HTTP 5xx).
+	ErrUnavailable = errors.New("crafty unavailable")
+
+	// ErrUnexpectedResponse is returned for any other error response from the Crafty API.
+	ErrUnexpectedResponse = errors.New("unexpected response")
 )
+
+// statusErrors maps HTTP status codes of Crafty responses to errors.
+var statusErrors = map[int]error{
+	http.StatusUnauthorized:    ErrUnauthorized,
+	http.StatusForbidden:       ErrForbidden,
+	http.StatusNotFound:        ErrNotFound,
+	http.StatusConflict:        ErrConflict,
+	http.StatusTooManyRequests: ErrRateLimited,
+}
+
+// codeErrors maps Crafty error codes to errors, for error envelopes sent with an unhelpful status code.
+var codeErrors = map[string]error{
+	"NOT_AUTHORIZED": ErrForbidden,
+	"NOT_FOUND":      ErrNotFound,
+	"SER_RUNNING":    ErrServerAlreadyRunning,
+}
@@ -1,5 +1,7 @@
 package crafty
 
+import "encoding/json"
+
 // LoginResponse represents the response returned by the Crafty API upon successful authentication.
 type LoginResponse struct {
 	Status string `json:"status"`
@@ -9,6 +11,25 @@ type LoginResponse struct {
 	} `json:"data"`
 }
 
+// ErrorResponse represents the envelope returned by the Crafty API when a request fails.
+type ErrorResponse struct {
+	Status    string          `json:"status"`     // "error" for failed requests
+	Error     string          `json:"error"`      // Error code, e.g. NOT_AUTHORIZED
+	ErrorData json.RawMessage `json:"error_data"` // Human-readable details, usually a string
+}
+
+// details returns the error data as text to append to an error message, or an empty string.
+func (e ErrorResponse) details() string {
+	var text string
+	if err := json.Unmarshal(e.ErrorData, &text); err != nil {
+		text = string(e.ErrorData)
+	}
+	if text == "" || text == "null" {
+		return ""
+	}
+	return ": " + text
+}
+
 // LoginPayload represents the payload used to authenticate with the Crafty API.
 type LoginPayload struct {
 	Username string `json:"username"` // Username for authentication
@@ -18,6 +39,7 @@ type LoginPayload struct {
 // Server represents a Minecraft server instance managed by the Crafty panel.
 type Server struct {
 	ServerID string `json:"server_id"`   // Unique ID of the server
+	Name     string `json:"server_name"` // Name of the server shown in the panel
 	Port     int    `json:"server_port"` // Port the server is listening on
 }
 
@@ -26,6 +48,20 @@ type ServerList struct {
 	Data []Server `json:"data"` // List of servers
 }
 
+// ServerStats represents the live state of a server reported by the Crafty stats endpoint.
+type ServerStats struct {
+	Running  bool `json:"running"`  // Whether the server process is running
+	Crashed  bool `json:"crashed"`  // Whether the server process has crashed
+	Updating bool `json:"updating"` // Whether Crafty is updating the server jar
+	Online   int  `json:"online"`   // Number of players online
+	Max      int  `json:"max"`      // Maximum number of players
+}
+
+// ServerStatsResponse represents the response of the Crafty stats endpoint.
+type ServerStatsResponse struct {
+	Data ServerStats `json:"data"`
+}
+
 // Settings represents a partial response from the Crafty API containing server-related configuration settings.
 type Settings struct {
 	Servers struct {
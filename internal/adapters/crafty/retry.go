@@ -0,0 +1,49 @@
+package crafty
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// maxRetryBackoff caps the delay between two attempts of an idempotent request.
+const maxRetryBackoff = 10 * time.Second
+
+// retry calls fn until it succeeds, fails permanently, runs out of attempts or ctx is done.
+// Attempts are spaced by an exponential backoff with jitter, so several proxies do not retry in lockstep.
+func (c *Crafty) retry(ctx context.Context, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !retryable(err) || attempt >= c.retries || ctx.Err() != nil {
+			return err
+		}
+
+		timer := time.NewTimer(backoff(c.retryBackoff, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable reports whether a failed request may succeed when sent again.
+func retryable(err error) bool {
+	return errors.Is(err, ErrHTTPRequestFailed) || errors.Is(err, ErrRateLimited) || errors.Is(err, ErrUnavailable)
+}
+
+// backoff returns the delay before the retry following the given attempt:
+// base doubled for every attempt, capped at maxRetryBackoff, of which a random half is kept.
+func backoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	delay := base
+	for i := 0; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxRetryBackoff)
+	return delay/2 + rand.N(delay/2+1) //nolint:gosec
+}
@@ -0,0 +1,69 @@
+package crafty
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/config"
+)
+
+// newTransport returns an HTTP transport for the Crafty API configured with the given TLS settings.
+func newTransport(cfg config.TLS) (*http.Transport, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify, //nolint:gosec
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidTLSConfig, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificates in %s", ErrInvalidTLSConfig, cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidTLSConfig, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if cfg.PinnedSHA256 != "" {
+		pin, err := hex.DecodeString(strings.ReplaceAll(cfg.PinnedSHA256, ":", ""))
+		if err != nil || len(pin) != sha256.Size {
+			return nil, fmt.Errorf("%w: pinned_sha256 is not a hex SHA-256 fingerprint", ErrInvalidTLSConfig)
+		}
+		// The pin identifies the certificate on its own, so self-signed Crafty certificates work without a CA.
+		tlsConfig.InsecureSkipVerify = true //nolint:gosec
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return ErrCertificateMismatch
+			}
+			fingerprint := sha256.Sum256(state.PeerCertificates[0].Raw)
+			if !bytes.Equal(fingerprint[:], pin) {
+				return fmt.Errorf("%w: got %s", ErrCertificateMismatch, hex.EncodeToString(fingerprint[:]))
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
@@ -0,0 +1,79 @@
+package crafty
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenRefreshMargin is how long before its expiry a token is refreshed.
+const tokenRefreshMargin = time.Minute
+
+// tokenManager caches the Crafty bearer token and logs in again when it expires or is rejected.
+// It is safe for concurrent use; concurrent callers share a single login.
+type tokenManager struct {
+	login func(ctx context.Context) (string, error)
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time // Zero if the token does not expire
+}
+
+// newTokenManager creates a token manager obtaining tokens with the given login function.
+func newTokenManager(login func(ctx context.Context) (string, error)) *tokenManager {
+	return &tokenManager{login: login}
+}
+
+// get returns a valid token, logging in if there is none or it is about to expire.
+func (tm *tokenManager) get(ctx context.Context) (string, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if tm.token != "" && (tm.expiresAt.IsZero() || time.Until(tm.expiresAt) > tokenRefreshMargin) {
+		return tm.token, nil
+	}
+
+	token, err := tm.login(ctx)
+	if err != nil {
+		return "", err
+	}
+	tm.token = token
+	tm.expiresAt = tokenExpiry(token)
+	return token, nil
+}
+
+// invalidate drops the token if it is still the cached one, so the next get logs in again.
+func (tm *tokenManager) invalidate(token string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if tm.token == token {
+		tm.token = ""
+		tm.expiresAt = time.Time{}
+	}
+}
+
+// tokenExpiry returns the expiry of a JWT from its "exp" claim,
+// or the zero time if the token carries no readable expiry.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+
+	var claims struct {
+		Exp float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(claims.Exp), 0)
+}
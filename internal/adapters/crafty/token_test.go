@@ -0,0 +1,92 @@
+package crafty
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// jwt returns a token with the given claims, signed with a dummy signature.
+func jwt(claims string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + encode([]byte(claims)) + ".c2lnbmF0dXJl"
+}
+
+func TestTokenExpiry(t *testing.T) {
+	exp := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		token string
+		want  time.Time
+	}{
+		{name: "valid", token: jwt(fmt.Sprintf(`{"user_id":"1","exp":%d}`, exp.Unix())), want: exp},
+		{name: "padded payload", token: "e30." + base64.URLEncoding.EncodeToString(fmt.Appendf(nil, `{"exp":%d,"ab":1}`, exp.Unix())) + ".c2ln", want: exp},
+		{name: "fractional exp", token: jwt(fmt.Sprintf(`{"exp":%d.5}`, exp.Unix())), want: exp},
+		{name: "without exp", token: jwt(`{"user_id":"1"}`)},
+		{name: "not a JWT", token: "opaque-api-token"},
+		{name: "bad base64", token: "header.!!!.signature"},
+		{name: "bad JSON", token: jwt(`{"exp":`)},
+		{name: "exp not a number", token: jwt(`{"exp":"tomorrow"}`)},
+	}
+	for _, tt := range tests {
+		if got := tokenExpiry(tt.token); !got.Equal(tt.want) {
+			t.Errorf("%s: tokenExpiry() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTokenManagerRefresh(t *testing.T) {
+	tests := []struct {
+		name       string
+		claims     string
+		wantLogins int // Logins after two calls to get
+	}{
+		{name: "valid token is cached", claims: fmt.Sprintf(`{"exp":%d}`, time.Now().Add(time.Hour).Unix()), wantLogins: 1},
+		{name: "token without exp is cached", claims: `{}`, wantLogins: 1},
+		{name: "token near expiry is refreshed", claims: fmt.Sprintf(`{"exp":%d}`, time.Now().Add(tokenRefreshMargin/2).Unix()), wantLogins: 2},
+		{name: "expired token is refreshed", claims: fmt.Sprintf(`{"exp":%d}`, time.Now().Add(-time.Hour).Unix()), wantLogins: 2},
+	}
+	for _, tt := range tests {
+		logins := 0
+		tm := newTokenManager(func(context.Context) (string, error) {
+			logins++
+			return jwt(tt.claims), nil
+		})
+
+		for range 2 {
+			if _, err := tm.get(context.Background()); err != nil {
+				t.Fatalf("%s: get() error = %v", tt.name, err)
+			}
+		}
+		if logins != tt.wantLogins {
+			t.Errorf("%s: logged in %d times, want %d", tt.name, logins, tt.wantLogins)
+		}
+	}
+}
+
+func TestTokenManagerInvalidate(t *testing.T) {
+	logins := 0
+	tm := newTokenManager(func(context.Context) (string, error) {
+		logins++
+		return fmt.Sprintf("token-%d", logins), nil
+	})
+	ctx := context.Background()
+
+	first, err := tm.get(ctx)
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	// A stale token rejected by a concurrent request does not drop the current one.
+	tm.invalidate("token-0")
+	if token, _ := tm.get(ctx); token != first {
+		t.Errorf("get() after invalidating another token = %q, want %q", token, first)
+	}
+
+	tm.invalidate(first)
+	if token, _ := tm.get(ctx); token != "token-2" {
+		t.Errorf("get() after invalidating the token = %q, want %q", token, "token-2")
+	}
+}
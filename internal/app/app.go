@@ -3,14 +3,15 @@ package app
 
 import (
 	"context"
-	"crypto/tls"
+	"errors"
 	"log"
-	"net/http"
 	"sync"
 	"time"
 
 	"github.com/sund3RRR/crafty-reverse-proxy/config"
 	"github.com/sund3RRR/crafty-reverse-proxy/internal/adapters/crafty"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/modules/admin"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/modules/balancer"
 	"github.com/sund3RRR/crafty-reverse-proxy/internal/modules/connector"
 	"github.com/sund3RRR/crafty-reverse-proxy/internal/modules/mc_operator"
 	"github.com/sund3RRR/crafty-reverse-proxy/internal/modules/proxy"
@@ -22,8 +23,15 @@ const (
 	startUpTimeout = 2 * time.Minute
 	// dialTimeout is the timeout for establishing connections to the Minecraft server.
 	dialTimeout = 3 * time.Minute
+	// protocolUDP is the listener protocol of Bedrock Edition servers.
+	protocolUDP = "udp"
 )
 
+// proxyServer is a listener proxying client traffic to Minecraft servers.
+type proxyServer interface {
+	ListenAndProxy(ctx context.Context) error
+}
+
 // App represents the main application, which handles the setup of multiple proxy servers.
 type App struct {
 	cfg    config.Config  // Configuration for the application.
@@ -44,39 +52,150 @@ func New(cfg config.Config, logger *logger.Logger, crafty *crafty.Crafty) *App {
 //
 // The app will start multiple proxy servers based on the provided configuration,
 // with each server handling connections from clients and proxying them to the Minecraft server.
+// When ctx is cancelled, the listeners are closed and active sessions are drained,
+// after which the Minecraft servers are optionally stopped.
 func (app *App) Run(ctx context.Context) {
 	var wg sync.WaitGroup
 
-	// Disable TLS verification for the HTTP client used to communicate with Crafty (for insecure environments).
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true} //nolint
+	// Connectors outlive the listeners, so draining sessions can still return their connections.
+	runCtx, stopConnectors := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopConnectors()
 
-	// For each address in the configuration, create and start a new proxy server.
+	// Addresses sharing a listener are served by a single proxy server and routed by hostname.
+	listeners := make(map[string][]proxy.Route)
+	var listenerKeys []string
+	var connectors []*connector.Connector
+	var operators []*mc_operator.ServerOperator
+	var adminServers []admin.Server
 	for _, address := range app.cfg.Addresses {
-		wg.Add(1)
-		go func(serverConfig config.ServerType) {
-			defer wg.Done()
+		// Every backend of the address gets its own operator and connector.
+		var backends []balancer.Backend
+		var routeConnector proxy.Connector
+		for _, backendType := range address.BackendTypes() {
+			connector, operator := app.newConnector(runCtx, backendType)
+			operators = append(operators, operator)
+			if routeConnector == nil {
+				routeConnector = connector
+			}
+			connectors = append(connectors, connector)
+			// The crafty_host address identifies the backend in the metrics, the admin API and the proxy alike.
+			backendAddress := backendType.CraftyHost.String()
+			registerConnectorMetrics(backendAddress, connector)
+			adminServers = append(adminServers, admin.Server{Address: backendAddress, Connector: connector})
+			backends = append(backends, balancer.Backend{Address: backendAddress, Connector: connector})
+		}
 
-			// Create a new Minecraft operator with the given server configuration.
-			mcOperator := mc_operator.New(
-				serverConfig,
-				startUpTimeout,
-				app.cfg.Timeout,
-				app.logger,
-				app.crafty,
-			)
+		// An address with a single backend is served by its connector directly.
+		if len(backends) > 1 {
+			routeConnector = balancer.New(app.strategy(address), app.logger, backends...)
+		}
 
-			// Create a new connector responsible for managing connections to the Minecraft server.
-			connector := connector.New(app.logger, app.cfg.AutoShutdown, mcOperator, dialTimeout)
+		key := address.ListenerKey()
+		if _, exists := listeners[key]; !exists {
+			listenerKeys = append(listenerKeys, key)
+		}
+		listeners[key] = append(listeners[key], proxy.Route{Config: address, Connector: routeConnector})
+	}
+
+	if app.cfg.Metrics.Enabled {
+		go app.serveMetrics(ctx)
+	}
+
+	if app.cfg.Admin.Enabled {
+		adminAPI := admin.New(app.cfg.Admin.Listener.String(), app.cfg.Admin.Token, app.logger, adminServers...)
+		go func() {
+			if err := adminAPI.ListenAndServe(ctx); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	// For each listener in the configuration, create and start a new proxy server.
+	for _, key := range listenerKeys {
+		wg.Add(1)
+		go func(routes []proxy.Route) {
+			defer wg.Done()
 
 			// Create a new proxy server and start it.
-			server := proxy.New(serverConfig, app.logger, connector)
+			listenerConfig := routes[0].Config
+			var server proxyServer = proxy.New(listenerConfig, app.cfg.DrainTimeout, app.logger, routes...)
+			if listenerConfig.Protocol == protocolUDP {
+				server = proxy.NewUDP(listenerConfig, app.cfg.DrainTimeout, app.logger, routes...)
+			}
 			if err := server.ListenAndProxy(ctx); err != nil {
 				// If an error occurs while starting the proxy server, log and terminate.
 				log.Fatal(err)
 			}
-		}(address)
+		}(listeners[key])
 	}
 
 	// Wait for all proxy servers to finish before exiting the app.
 	wg.Wait()
+
+	if app.cfg.StopServersOnExit {
+		// The RCON countdown would hold up the exit, so players are not warned.
+		for _, operator := range operators {
+			operator.SkipCountdown()
+		}
+		app.stopServers(runCtx, connectors)
+	}
+	app.logger.Info("Reverse proxy stopped")
+}
+
+// newConnector creates the operator and connector of a single Minecraft server and starts the loops watching it.
+func (app *App) newConnector(ctx context.Context, serverType config.ServerType) (*connector.Connector, *mc_operator.ServerOperator) {
+	// Create a new Minecraft operator with the given server configuration.
+	mcOperator := mc_operator.New(
+		serverType,
+		startUpTimeout,
+		app.cfg.Timeout,
+		app.logger,
+		app.crafty,
+	)
+
+	// Create a new connector responsible for managing connections to the Minecraft server.
+	connector := connector.New(app.logger, app.cfg.AutoShutdown, app.shutdownMode(), mcOperator, dialTimeout)
+	connector.StartLoop(ctx)
+	if app.cfg.ShutdownMode == config.ShutdownModePlayers {
+		go mc_operator.NewIdleWatcher(mcOperator, connector, app.cfg.IdleCheckInterval, app.logger).Run(ctx)
+	}
+	if app.cfg.ReconcileInterval > 0 {
+		go mc_operator.NewReconciler(mcOperator, connector, app.cfg.ReconcileInterval, app.logger).Run(ctx)
+	}
+	return connector, mcOperator
+}
+
+// strategy returns the balancer strategy for the configured strategy of an address.
+func (app *App) strategy(address config.ServerType) balancer.Strategy {
+	switch address.Strategy {
+	case config.StrategyRoundRobin:
+		return balancer.RoundRobin
+	case config.StrategyLeastConnections:
+		return balancer.LeastConnections
+	default:
+		return balancer.FirstAvailable
+	}
+}
+
+// shutdownMode returns the connector shutdown mode for the configured auto shutdown mode.
+func (app *App) shutdownMode() connector.ShutdownMode {
+	if app.cfg.ShutdownMode == config.ShutdownModePlayers {
+		return connector.ShutdownOnIdle
+	}
+	return connector.ShutdownOnEmpty
+}
+
+// stopServers stops every Minecraft server managed by the given connectors.
+func (app *App) stopServers(ctx context.Context, connectors []*connector.Connector) {
+	var wg sync.WaitGroup
+	for _, server := range connectors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.StopServer(ctx); err != nil && !errors.Is(err, connector.ErrNotRunning) {
+				app.logger.Error("Failed to stop MC server on exit: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
 }
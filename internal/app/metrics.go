@@ -0,0 +1,51 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/metrics"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/modules/connector"
+)
+
+// metricsReadHeaderTimeout bounds the time a metrics scraper has to send its request headers.
+const metricsReadHeaderTimeout = 10 * time.Second
+
+// registerConnectorMetrics exposes the state and player count of a connector under the given address.
+func registerConnectorMetrics(address string, conn *connector.Connector) {
+	for _, stateName := range connector.States() {
+		metrics.ServerState.Register(func() float64 {
+			if conn.ServerState() == stateName {
+				return 1
+			}
+			return 0
+		}, address, stateName)
+	}
+	metrics.PlayerCount.Register(func() float64 {
+		return float64(conn.PlayerCount())
+	}, address)
+}
+
+// serveMetrics serves the Prometheus metrics endpoint until ctx is cancelled.
+func (app *App) serveMetrics(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Registry)
+
+	server := &http.Server{
+		Addr:              app.cfg.Metrics.Listener.String(),
+		Handler:           mux,
+		ReadHeaderTimeout: metricsReadHeaderTimeout,
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	app.logger.Info("Metrics endpoint running on %s/metrics", server.Addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
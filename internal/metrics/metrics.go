@@ -0,0 +1,67 @@
+// Package metrics defines the metrics exported by the reverse proxy.
+package metrics
+
+import (
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/metrics"
+)
+
+// Registry holds every metric of the reverse proxy.
+var Registry = metrics.NewRegistry()
+
+// Label values used by the metrics.
+const (
+	// DirectionClientToServer labels traffic sent by players to the Minecraft server.
+	DirectionClientToServer = "client_to_server"
+	// DirectionServerToClient labels traffic sent by the Minecraft server to players.
+	DirectionServerToClient = "server_to_client"
+
+	// ActionStart labels Crafty start server calls.
+	ActionStart = "start"
+	// ActionStop labels Crafty stop server calls.
+	ActionStop = "stop"
+
+	// ResultSuccess labels calls that succeeded.
+	ResultSuccess = "success"
+	// ResultFailure labels calls that failed.
+	ResultFailure = "failure"
+)
+
+var (
+	// ServerState reports 1 for the current connector state of each address and 0 for the others.
+	ServerState = Registry.NewGaugeFuncVec("crafty_proxy_server_state",
+		"Current connector state of the Minecraft server.", "address", "state")
+
+	// PlayerCount reports the number of players the connector counts for each address.
+	PlayerCount = Registry.NewGaugeFuncVec("crafty_proxy_players",
+		"Current number of players connected through the proxy.", "address")
+
+	// ConnectionsAccepted counts client connections accepted for each address.
+	ConnectionsAccepted = Registry.NewCounterVec("crafty_proxy_connections_accepted_total",
+		"Total number of client connections accepted.", "address")
+
+	// BytesProxied counts bytes proxied for each address and direction.
+	BytesProxied = Registry.NewCounterVec("crafty_proxy_bytes_total",
+		"Total number of bytes proxied.", "address", "direction")
+
+	// ServerActions counts start and stop calls to Crafty for each address by result.
+	ServerActions = Registry.NewCounterVec("crafty_proxy_server_actions_total",
+		"Total number of start and stop calls to Crafty.", "address", "action", "result")
+
+	// ColdStartDuration observes the time from a start request until the server accepts connections.
+	ColdStartDuration = Registry.NewHistogramVec("crafty_proxy_cold_start_duration_seconds",
+		"Time waited for the Minecraft server to come up after a start.",
+		[]float64{5, 10, 20, 30, 45, 60, 90, 120, 180}, "address", "result")
+
+	// CraftyRequestDuration observes the latency of Crafty API requests by endpoint.
+	CraftyRequestDuration = Registry.NewHistogramVec("crafty_proxy_crafty_request_duration_seconds",
+		"Latency of Crafty API requests.",
+		[]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}, "endpoint", "result")
+)
+
+// Result returns the result label value for err.
+func Result(err error) string {
+	if err != nil {
+		return ResultFailure
+	}
+	return ResultSuccess
+}
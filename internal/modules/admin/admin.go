@@ -0,0 +1,271 @@
+// Package admin provides an authenticated HTTP API to inspect and control the managed Minecraft servers.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/modules/connector"
+)
+
+const (
+	// readHeaderTimeout bounds the time a client has to send its request headers.
+	readHeaderTimeout = 10 * time.Second
+	// maxBodySize caps the size of request bodies.
+	maxBodySize = 1 << 16
+)
+
+var (
+	// ErrNoToken is returned when the admin API is enabled without an access token.
+	ErrNoToken = errors.New("admin API requires a token")
+)
+
+// Logger defines the logging interface used by the admin API.
+type Logger interface {
+	Debug(format string, args ...any)
+	Warn(format string, args ...any)
+	Info(format string, args ...any)
+	Error(format string, args ...any)
+}
+
+// Connector defines the interface for inspecting and controlling a Minecraft server.
+type Connector interface {
+	ServerState() string
+	PlayerCount() int
+	AutoShutdown() bool
+	ShutdownDeadline() (time.Time, bool)
+	LastError() error
+	StartServer(ctx context.Context) error
+	StopServer(ctx context.Context) error
+	CancelShutdown(ctx context.Context) error
+	ExtendShutdown(ctx context.Context, extra time.Duration) error
+	SetAutoShutdown(ctx context.Context, enabled bool) error
+}
+
+// Server is a managed Minecraft server exposed by the admin API.
+type Server struct {
+	Address   string    // Address of the Minecraft server, used for display
+	Connector Connector // Connector managing the Minecraft server
+}
+
+// API serves the admin HTTP API.
+type API struct {
+	listenAddr string
+	token      string
+	servers    []Server
+	logger     Logger
+}
+
+// serverStatus is the JSON representation of a managed server.
+type serverStatus struct {
+	ID               int        `json:"id"`
+	Address          string     `json:"address"`
+	State            string     `json:"state"`
+	PlayerCount      int        `json:"player_count"`
+	AutoShutdown     bool       `json:"auto_shutdown"`
+	ShutdownDeadline *time.Time `json:"shutdown_deadline,omitempty"`
+	LastError        string     `json:"last_error,omitempty"`
+}
+
+// errorResponse is the JSON body of a failed request.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// New creates a new admin API listening on listenAddr and requiring the given bearer token.
+func New(listenAddr, token string, logger Logger, servers ...Server) *API {
+	return &API{
+		listenAddr: listenAddr,
+		token:      token,
+		servers:    servers,
+		logger:     logger,
+	}
+}
+
+// ListenAndServe serves the admin API until ctx is cancelled.
+func (api *API) ListenAndServe(ctx context.Context) error {
+	if api.token == "" {
+		return ErrNoToken
+	}
+
+	server := &http.Server{
+		Addr:              api.listenAddr,
+		Handler:           api.Handler(),
+		ReadHeaderTimeout: readHeaderTimeout,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	api.logger.Info("Admin API running on %s", api.listenAddr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Handler returns the HTTP handler of the admin API.
+//
+//	GET  /api/servers                          lists the managed servers
+//	GET  /api/servers/{id}                     shows a single server
+//	POST /api/servers/{id}/start               starts the server and waits for it to come up
+//	POST /api/servers/{id}/stop                stops the server after the RCON countdown
+//	POST /api/servers/{id}/shutdown/cancel     cancels the pending shutdown
+//	POST /api/servers/{id}/shutdown/extend     postpones the pending shutdown, body {"duration": "10m"}
+//	PUT  /api/servers/{id}/auto-shutdown       toggles auto shutdown, body {"enabled": false}
+func (api *API) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/servers", api.listServers)
+	mux.HandleFunc("GET /api/servers/{id}", api.withServer(api.getServer))
+	mux.HandleFunc("POST /api/servers/{id}/start", api.withServer(api.startServer))
+	mux.HandleFunc("POST /api/servers/{id}/stop", api.withServer(api.stopServer))
+	mux.HandleFunc("POST /api/servers/{id}/shutdown/cancel", api.withServer(api.cancelShutdown))
+	mux.HandleFunc("POST /api/servers/{id}/shutdown/extend", api.withServer(api.extendShutdown))
+	mux.HandleFunc("PUT /api/servers/{id}/auto-shutdown", api.withServer(api.setAutoShutdown))
+	return api.authenticate(mux)
+}
+
+// authenticate rejects requests without the configured bearer token.
+func (api *API) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(api.token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withServer resolves the {id} path value to a managed server.
+func (api *API) withServer(handler func(w http.ResponseWriter, r *http.Request, id int)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id < 0 || id >= len(api.servers) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "no such server"})
+			return
+		}
+		handler(w, r, id)
+	}
+}
+
+func (api *API) listServers(w http.ResponseWriter, _ *http.Request) {
+	statuses := make([]serverStatus, 0, len(api.servers))
+	for id := range api.servers {
+		statuses = append(statuses, api.status(id))
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (api *API) getServer(w http.ResponseWriter, _ *http.Request, id int) {
+	writeJSON(w, http.StatusOK, api.status(id))
+}
+
+func (api *API) startServer(w http.ResponseWriter, r *http.Request, id int) {
+	api.logger.Info("Admin API: starting MC server %s", api.servers[id].Address)
+	api.respond(w, id, api.servers[id].Connector.StartServer(r.Context()))
+}
+
+func (api *API) stopServer(w http.ResponseWriter, r *http.Request, id int) {
+	api.logger.Info("Admin API: stopping MC server %s", api.servers[id].Address)
+	api.respond(w, id, api.servers[id].Connector.StopServer(r.Context()))
+}
+
+func (api *API) cancelShutdown(w http.ResponseWriter, r *http.Request, id int) {
+	api.logger.Info("Admin API: cancelling shutdown of MC server %s", api.servers[id].Address)
+	api.respond(w, id, api.servers[id].Connector.CancelShutdown(r.Context()))
+}
+
+func (api *API) extendShutdown(w http.ResponseWriter, r *http.Request, id int) {
+	var body struct {
+		Duration string `json:"duration"`
+	}
+	if err := decodeJSON(r, &body); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	extra, err := time.ParseDuration(body.Duration)
+	if err != nil || extra <= 0 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "duration must be a positive duration like \"10m\""})
+		return
+	}
+
+	api.logger.Info("Admin API: postponing shutdown of MC server %s by %s", api.servers[id].Address, extra)
+	api.respond(w, id, api.servers[id].Connector.ExtendShutdown(r.Context(), extra))
+}
+
+func (api *API) setAutoShutdown(w http.ResponseWriter, r *http.Request, id int) {
+	var body struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := decodeJSON(r, &body); err != nil || body.Enabled == nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "body must be {\"enabled\": true|false}"})
+		return
+	}
+
+	api.logger.Info("Admin API: setting auto shutdown of MC server %s to %t", api.servers[id].Address, *body.Enabled)
+	api.respond(w, id, api.servers[id].Connector.SetAutoShutdown(r.Context(), *body.Enabled))
+}
+
+// respond writes the server status on success, or the error otherwise.
+func (api *API) respond(w http.ResponseWriter, id int, err error) {
+	if err != nil {
+		writeJSON(w, statusCode(err), errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, api.status(id))
+}
+
+// status returns the current status of the server with the given id.
+func (api *API) status(id int) serverStatus {
+	server := api.servers[id]
+	status := serverStatus{
+		ID:           id,
+		Address:      server.Address,
+		State:        server.Connector.ServerState(),
+		PlayerCount:  server.Connector.PlayerCount(),
+		AutoShutdown: server.Connector.AutoShutdown(),
+	}
+	if deadline, ok := server.Connector.ShutdownDeadline(); ok {
+		status.ShutdownDeadline = &deadline
+	}
+	if err := server.Connector.LastError(); err != nil {
+		status.LastError = err.Error()
+	}
+	return status
+}
+
+// statusCode maps a connector error to an HTTP status code.
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, connector.ErrNoShutdownScheduled), errors.Is(err, connector.ErrNotRunning):
+		return http.StatusConflict
+	case errors.Is(err, connector.ErrRateLimited):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+func decodeJSON(r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
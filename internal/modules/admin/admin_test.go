@@ -0,0 +1,166 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/modules/connector"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/testutil"
+)
+
+const token = "secret"
+
+// fakeConnector records the actions called on it and fails them with err.
+type fakeConnector struct {
+	err     error
+	actions []string
+}
+
+func (f *fakeConnector) ServerState() string                 { return "Empty" }
+func (f *fakeConnector) PlayerCount() int                    { return 3 }
+func (f *fakeConnector) AutoShutdown() bool                  { return true }
+func (f *fakeConnector) ShutdownDeadline() (time.Time, bool) { return time.Time{}, false }
+func (f *fakeConnector) LastError() error                    { return nil }
+
+func (f *fakeConnector) StartServer(context.Context) error { return f.record("start") }
+func (f *fakeConnector) StopServer(context.Context) error  { return f.record("stop") }
+
+func (f *fakeConnector) CancelShutdown(context.Context) error { return f.record("cancel") }
+
+func (f *fakeConnector) ExtendShutdown(_ context.Context, extra time.Duration) error {
+	return f.record("extend " + extra.String())
+}
+
+func (f *fakeConnector) SetAutoShutdown(_ context.Context, enabled bool) error {
+	return f.record(fmt.Sprintf("auto-shutdown %t", enabled))
+}
+
+func (f *fakeConnector) record(action string) error {
+	f.actions = append(f.actions, action)
+	return f.err
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		token      string
+		err        error
+		wantCode   int
+		wantAction string // Action called on the connector, if any
+	}{
+		{name: "missing token", method: http.MethodGet, path: "/api/servers", wantCode: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodPost, path: "/api/servers/0/stop", token: "guess", wantCode: http.StatusUnauthorized},
+		{name: "list", method: http.MethodGet, path: "/api/servers", token: token, wantCode: http.StatusOK},
+		{name: "show", method: http.MethodGet, path: "/api/servers/0", token: token, wantCode: http.StatusOK},
+		{name: "unknown id", method: http.MethodGet, path: "/api/servers/1", token: token, wantCode: http.StatusNotFound},
+		{name: "negative id", method: http.MethodPost, path: "/api/servers/-1/start", token: token, wantCode: http.StatusNotFound},
+		{name: "id not a number", method: http.MethodPost, path: "/api/servers/lobby/start", token: token, wantCode: http.StatusNotFound},
+		{name: "start", method: http.MethodPost, path: "/api/servers/0/start", token: token, wantCode: http.StatusOK, wantAction: "start"},
+		{name: "stop", method: http.MethodPost, path: "/api/servers/0/stop", token: token, wantCode: http.StatusOK, wantAction: "stop"},
+		{name: "cancel shutdown", method: http.MethodPost, path: "/api/servers/0/shutdown/cancel", token: token, wantCode: http.StatusOK, wantAction: "cancel"},
+		{
+			name: "extend shutdown", method: http.MethodPost, path: "/api/servers/0/shutdown/extend", body: `{"duration":"10m"}`,
+			token: token, wantCode: http.StatusOK, wantAction: "extend 10m0s",
+		},
+		{
+			name: "extend by a negative duration", method: http.MethodPost, path: "/api/servers/0/shutdown/extend", body: `{"duration":"-1m"}`,
+			token: token, wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "extend without duration", method: http.MethodPost, path: "/api/servers/0/shutdown/extend", body: `{}`,
+			token: token, wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "extend with unknown field", method: http.MethodPost, path: "/api/servers/0/shutdown/extend", body: `{"minutes":10}`,
+			token: token, wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "disable auto shutdown", method: http.MethodPut, path: "/api/servers/0/auto-shutdown", body: `{"enabled":false}`,
+			token: token, wantCode: http.StatusOK, wantAction: "auto-shutdown false",
+		},
+		{
+			name: "toggle without enabled", method: http.MethodPut, path: "/api/servers/0/auto-shutdown", body: `{}`,
+			token: token, wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "toggle with invalid JSON", method: http.MethodPut, path: "/api/servers/0/auto-shutdown", body: `{"enabled":`,
+			token: token, wantCode: http.StatusBadRequest,
+		},
+		{name: "wrong method", method: http.MethodGet, path: "/api/servers/0/stop", token: token, wantCode: http.StatusMethodNotAllowed},
+		{
+			name: "no shutdown scheduled", method: http.MethodPost, path: "/api/servers/0/shutdown/cancel", token: token,
+			err: connector.ErrNoShutdownScheduled, wantCode: http.StatusConflict, wantAction: "cancel",
+		},
+		{
+			name: "not running", method: http.MethodPost, path: "/api/servers/0/stop", token: token,
+			err: connector.ErrNotRunning, wantCode: http.StatusConflict, wantAction: "stop",
+		},
+		{
+			name: "rate limited", method: http.MethodPost, path: "/api/servers/0/start", token: token,
+			err: fmt.Errorf("%w: not retrying", connector.ErrRateLimited), wantCode: http.StatusTooManyRequests, wantAction: "start",
+		},
+		{
+			name: "timed out", method: http.MethodPost, path: "/api/servers/0/start", token: token,
+			err: context.Canceled, wantCode: http.StatusGatewayTimeout, wantAction: "start",
+		},
+		{
+			name: "crafty failure", method: http.MethodPost, path: "/api/servers/0/start", token: token,
+			err: errors.New("crafty unavailable"), wantCode: http.StatusBadGateway, wantAction: "start",
+		},
+	}
+	for _, tt := range tests {
+		fake := &fakeConnector{err: tt.err}
+		api := New("", token, testutil.Logger{T: t}, Server{Address: "crafty:25565", Connector: fake})
+
+		request := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if tt.token != "" {
+			request.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		recorder := httptest.NewRecorder()
+		api.Handler().ServeHTTP(recorder, request)
+
+		if recorder.Code != tt.wantCode {
+			t.Errorf("%s: %s %s = %d, want %d", tt.name, tt.method, tt.path, recorder.Code, tt.wantCode)
+		}
+		if action := strings.Join(fake.actions, ", "); action != tt.wantAction {
+			t.Errorf("%s: connector actions = %q, want %q", tt.name, action, tt.wantAction)
+		}
+		if tt.err != nil && !strings.Contains(recorder.Body.String(), tt.err.Error()) {
+			t.Errorf("%s: body = %s, want the error %q", tt.name, recorder.Body.String(), tt.err)
+		}
+	}
+}
+
+func TestStatusBody(t *testing.T) {
+	api := New("", token, testutil.Logger{T: t}, Server{Address: "crafty:25565", Connector: &fakeConnector{}})
+	request := httptest.NewRequest(http.MethodGet, "/api/servers", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	recorder := httptest.NewRecorder()
+	api.Handler().ServeHTTP(recorder, request)
+
+	var statuses []serverStatus
+	if err := json.NewDecoder(recorder.Body).Decode(&statuses); err != nil {
+		t.Fatalf("decoding the server list: %v", err)
+	}
+	want := serverStatus{ID: 0, Address: "crafty:25565", State: "Empty", PlayerCount: 3, AutoShutdown: true}
+	if len(statuses) != 1 || statuses[0] != want {
+		t.Errorf("server list = %+v, want [%+v]", statuses, want)
+	}
+}
+
+func TestListenAndServeRequiresToken(t *testing.T) {
+	api := New("127.0.0.1:0", "", testutil.Logger{T: t})
+	if err := api.ListenAndServe(context.Background()); !errors.Is(err, ErrNoToken) {
+		t.Fatalf("ListenAndServe() error = %v, want %v", err, ErrNoToken)
+	}
+}
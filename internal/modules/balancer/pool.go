@@ -0,0 +1,281 @@
+// Package balancer spreads the players of an address over several Minecraft servers and fails over
+// to the next server when one does not come up.
+package balancer
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/modules/connector"
+)
+
+// Connector state names the pool reports.
+const (
+	stateStartingUp = "StartingUp"
+	stateRunning    = "Running"
+	stateEmpty      = "Empty"
+)
+
+var (
+	// ErrNoBackend is returned when none of the backends could be connected to.
+	ErrNoBackend = errors.New("no backend available")
+)
+
+// Strategy selects which running backend a new connection goes to.
+type Strategy int
+
+const (
+	// FirstAvailable picks the first running backend in the configured order.
+	FirstAvailable Strategy = iota
+	// RoundRobin picks the running backends in turn.
+	RoundRobin
+	// LeastConnections picks the running backend with the fewest connections through the pool.
+	LeastConnections
+)
+
+// Logger defines the logging interface used by the Pool.
+type Logger interface {
+	Debug(format string, args ...any)
+	Warn(format string, args ...any)
+	Info(format string, args ...any)
+	Error(format string, args ...any)
+}
+
+// Connector defines the interface for managing the connections to a single Minecraft server.
+type Connector interface {
+	GetConnection(ctx context.Context) (net.Conn, error)
+	GetStatusConnection(ctx context.Context) (net.Conn, error)
+	PutConnection(ctx context.Context, conn net.Conn) error
+	PlayerJoined(ctx context.Context, conn net.Conn) error
+	StartServer(ctx context.Context) error
+	ServerUp() bool
+	ServerState() string
+}
+
+// Backend is a Minecraft server of the pool.
+type Backend struct {
+	Address   string    // Address of the Minecraft server, used for logging
+	Connector Connector // Connector managing the Minecraft server
+}
+
+// Pool is a connector over several backends. Connections go to the running backends as picked by the strategy.
+// If none is running, the backends are started in the configured order, so the next one is only started
+// when the previous one fails to come up.
+type Pool struct {
+	strategy Strategy
+	backends []Backend
+	logger   Logger
+
+	mu     sync.Mutex
+	next   int              // Backend the next round-robin pick starts at
+	active []int            // Connections handed out per backend
+	owners map[net.Conn]int // Backend each handed out connection belongs to
+	waking bool             // Whether a wake-up is in progress
+}
+
+// New creates a pool over the given backends, the first of which is the primary one.
+func New(strategy Strategy, logger Logger, backends ...Backend) *Pool {
+	return &Pool{
+		strategy: strategy,
+		backends: backends,
+		logger:   logger,
+		active:   make([]int, len(backends)),
+		owners:   make(map[net.Conn]int),
+	}
+}
+
+// GetConnection requests a connection for a player logging in.
+// If no backend is running, the backends are started one after another until one comes up.
+func (p *Pool) GetConnection(ctx context.Context) (net.Conn, error) {
+	if running := p.pick(); len(running) > 0 {
+		return p.connect(ctx, running, Connector.GetConnection)
+	}
+	return p.failover(ctx, Connector.GetConnection)
+}
+
+// GetStatusConnection requests a connection for a server list ping.
+// If no backend is running, only the primary backend is asked, so pings never start a fallback.
+func (p *Pool) GetStatusConnection(ctx context.Context) (net.Conn, error) {
+	if running := p.pick(); len(running) > 0 {
+		return p.connect(ctx, running, Connector.GetStatusConnection)
+	}
+	conn, err := p.backends[0].Connector.GetStatusConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.track(conn, 0)
+	return conn, nil
+}
+
+// PutConnection returns a connection to the backend it was obtained from.
+func (p *Pool) PutConnection(ctx context.Context, conn net.Conn) error {
+	if conn == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	i, ok := p.owners[conn]
+	if ok {
+		delete(p.owners, conn)
+		p.active[i]--
+	}
+	p.mu.Unlock()
+
+	if !ok {
+		return conn.Close()
+	}
+	return p.backends[i].Connector.PutConnection(ctx, conn)
+}
+
+// PlayerJoined reports a joined player to the backend the connection belongs to.
+func (p *Pool) PlayerJoined(ctx context.Context, conn net.Conn) error {
+	p.mu.Lock()
+	i, ok := p.owners[conn]
+	p.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return p.backends[i].Connector.PlayerJoined(ctx, conn)
+}
+
+// WakeUp starts the backends in the background unless one is running or starting already.
+// The next backend is only started if the previous one fails to come up.
+func (p *Pool) WakeUp(ctx context.Context) error {
+	if state := p.ServerState(); state == stateRunning || state == stateEmpty || state == stateStartingUp {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.waking {
+		return nil
+	}
+	p.waking = true
+
+	go func() {
+		defer func() {
+			p.mu.Lock()
+			p.waking = false
+			p.mu.Unlock()
+		}()
+		// The wake-up outlives the client session that triggered it.
+		if _, err := p.failover(context.WithoutCancel(ctx), func(c Connector, ctx context.Context) (net.Conn, error) {
+			return nil, c.StartServer(ctx)
+		}); err != nil {
+			p.logger.Error("Failed to wake up any backend: %v", err)
+		}
+	}()
+	return nil
+}
+
+// BackendAddress returns the address of the backend a connection was obtained from.
+func (p *Pool) BackendAddress(conn net.Conn) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	i, ok := p.owners[conn]
+	if !ok {
+		return "", false
+	}
+	return p.backends[i].Address, true
+}
+
+// ServerState returns the state of the most available backend, or the state of the primary backend
+// if none is running or starting.
+func (p *Pool) ServerState() string {
+	states := make([]string, 0, len(p.backends))
+	for _, backend := range p.backends {
+		states = append(states, backend.Connector.ServerState())
+	}
+	for _, state := range []string{stateRunning, stateEmpty, stateStartingUp} {
+		if slices.Contains(states, state) {
+			return state
+		}
+	}
+	return states[0]
+}
+
+// connect obtains a connection from the first of the running backends that can be connected to.
+func (p *Pool) connect(ctx context.Context, running []int, get func(Connector, context.Context) (net.Conn, error)) (net.Conn, error) {
+	var errs []error
+	for _, i := range running {
+		conn, err := get(p.backends[i].Connector, ctx)
+		if err == nil {
+			p.track(conn, i)
+			return conn, nil
+		}
+		p.logger.Warn("Failed to connect to backend %s: %v", p.backends[i].Address, err)
+		errs = append(errs, fmt.Errorf("%s: %w", p.backends[i].Address, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// failover tries the backends in the configured order until one comes up.
+// The next backend is only tried if the previous one did not start in time or is crashed; a crashed backend
+// fails right away while its crash backoff lasts. Any other error is returned as is.
+func (p *Pool) failover(ctx context.Context, get func(Connector, context.Context) (net.Conn, error)) (net.Conn, error) {
+	var errs []error
+	for i, backend := range p.backends {
+		conn, err := get(backend.Connector, ctx)
+		if err == nil {
+			if conn != nil {
+				p.track(conn, i)
+			}
+			return conn, nil
+		}
+		if !errors.Is(err, connector.ErrStartTimeout) && !errors.Is(err, connector.ErrServerCrashed) {
+			return nil, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", backend.Address, err))
+		if ctx.Err() != nil {
+			break
+		}
+		if i < len(p.backends)-1 {
+			p.logger.Warn("Backend %s did not come up, falling back to %s: %v", backend.Address, p.backends[i+1].Address, err)
+		}
+	}
+	return nil, fmt.Errorf("%w: %w", ErrNoBackend, errors.Join(errs...))
+}
+
+// pick returns the running backends in the order the strategy prefers them.
+func (p *Pool) pick() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	running := make([]int, 0, len(p.backends))
+	for i, backend := range p.backends {
+		if backend.Connector.ServerUp() {
+			running = append(running, i)
+		}
+	}
+	if len(running) == 0 {
+		return nil
+	}
+
+	switch p.strategy {
+	case RoundRobin:
+		start := slices.IndexFunc(running, func(i int) bool { return i >= p.next })
+		if start < 0 {
+			start = 0
+		}
+		running = slices.Concat(running[start:], running[:start])
+		p.next = running[0] + 1
+	case LeastConnections:
+		slices.SortStableFunc(running, func(a, b int) int { return cmp.Compare(p.active[a], p.active[b]) })
+	}
+	return running
+}
+
+// track remembers the backend a connection was obtained from.
+func (p *Pool) track(conn net.Conn, i int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.owners[conn] = i
+	p.active[i]++
+}
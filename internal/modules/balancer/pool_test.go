@@ -0,0 +1,282 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/modules/connector"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/testutil"
+)
+
+// errStart is the error of a backend that did not come up within the start-up timeout.
+var errStart = fmt.Errorf("%w: did not come up", connector.ErrStartTimeout)
+
+// fakeConnector is a Connector whose server comes up on the first request unless startErr is set.
+type fakeConnector struct {
+	mu       sync.Mutex
+	up       bool
+	startErr error
+	starts   int
+	conns    map[net.Conn]bool // Handed out connections, true once the player joined
+}
+
+func (f *fakeConnector) start() error {
+	if f.up {
+		return nil
+	}
+	f.starts++
+	if f.startErr != nil {
+		return f.startErr
+	}
+	f.up = true
+	return nil
+}
+
+func (f *fakeConnector) GetConnection(context.Context) (net.Conn, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.start(); err != nil {
+		return nil, err
+	}
+	if f.conns == nil {
+		f.conns = make(map[net.Conn]bool)
+	}
+	conn, _ := net.Pipe()
+	f.conns[conn] = false
+	return conn, nil
+}
+
+func (f *fakeConnector) GetStatusConnection(ctx context.Context) (net.Conn, error) {
+	return f.GetConnection(ctx)
+}
+
+func (f *fakeConnector) PutConnection(_ context.Context, conn net.Conn) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.conns, conn)
+	return conn.Close()
+}
+
+func (f *fakeConnector) PlayerJoined(_ context.Context, conn net.Conn) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.conns[conn]; ok {
+		f.conns[conn] = true
+	}
+	return nil
+}
+
+func (f *fakeConnector) StartServer(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.start()
+}
+
+func (f *fakeConnector) ServerUp() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.up
+}
+
+func (f *fakeConnector) ServerState() string {
+	if f.ServerUp() {
+		return stateEmpty
+	}
+	return "Off"
+}
+
+func (f *fakeConnector) startCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.starts
+}
+
+func (f *fakeConnector) connCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.conns)
+}
+
+func newPool(t *testing.T, strategy Strategy, connectors ...*fakeConnector) *Pool {
+	t.Helper()
+	backends := make([]Backend, 0, len(connectors))
+	for i, c := range connectors {
+		backends = append(backends, Backend{Address: string(rune('a' + i)), Connector: c})
+	}
+	return New(strategy, testutil.Logger{T: t}, backends...)
+}
+
+func TestFailoverStartsFallbackOnlyIfPrimaryFails(t *testing.T) {
+	primary, fallback := &fakeConnector{}, &fakeConnector{}
+	pool := newPool(t, FirstAvailable, primary, fallback)
+
+	if _, err := pool.GetConnection(context.Background()); err != nil {
+		t.Fatalf("GetConnection() error = %v", err)
+	}
+	if primary.startCount() != 1 || fallback.startCount() != 0 {
+		t.Fatalf("starts = %d, %d, want 1, 0", primary.startCount(), fallback.startCount())
+	}
+
+	primary, fallback = &fakeConnector{startErr: errStart}, &fakeConnector{}
+	pool = newPool(t, FirstAvailable, primary, fallback)
+	if _, err := pool.GetConnection(context.Background()); err != nil {
+		t.Fatalf("GetConnection() error = %v", err)
+	}
+	if fallback.connCount() != 1 {
+		t.Errorf("fallback has %d connections, want 1", fallback.connCount())
+	}
+	if state := pool.ServerState(); state != stateEmpty {
+		t.Errorf("ServerState() = %s, want %s", state, stateEmpty)
+	}
+}
+
+func TestAllBackendsFail(t *testing.T) {
+	pool := newPool(t, FirstAvailable, &fakeConnector{startErr: errStart}, &fakeConnector{startErr: errStart})
+
+	_, err := pool.GetConnection(context.Background())
+	if !errors.Is(err, ErrNoBackend) || !errors.Is(err, errStart) {
+		t.Fatalf("GetConnection() error = %v, want %v and %v", err, ErrNoBackend, errStart)
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy Strategy
+		want     []int // Backend of every connection
+	}{
+		{name: "first available", strategy: FirstAvailable, want: []int{1, 1, 1, 1}},
+		{name: "round robin", strategy: RoundRobin, want: []int{1, 2, 1, 2}},
+		{name: "least connections", strategy: LeastConnections, want: []int{1, 2, 1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connectors := []*fakeConnector{&fakeConnector{}, &fakeConnector{up: true}, &fakeConnector{up: true}}
+			pool := newPool(t, tt.strategy, connectors...)
+
+			for n, want := range tt.want {
+				conn, err := pool.GetConnection(context.Background())
+				if err != nil {
+					t.Fatalf("GetConnection() error = %v", err)
+				}
+				if _, ok := connectors[want].conns[conn]; !ok {
+					t.Fatalf("connection %d did not go to backend %d", n, want)
+				}
+			}
+			if starts := connectors[0].startCount(); starts != 0 {
+				t.Errorf("stopped backend started %d times, want 0", starts)
+			}
+		})
+	}
+}
+
+func TestLeastConnectionsCountsReturnedConnections(t *testing.T) {
+	first, second := &fakeConnector{up: true}, &fakeConnector{up: true}
+	pool := newPool(t, LeastConnections, first, second)
+	ctx := context.Background()
+
+	conn, err := pool.GetConnection(ctx)
+	if err != nil {
+		t.Fatalf("GetConnection() error = %v", err)
+	}
+	if err := pool.PlayerJoined(ctx, conn); err != nil {
+		t.Fatalf("PlayerJoined() error = %v", err)
+	}
+	if !first.conns[conn] {
+		t.Fatal("joined player was not reported to the backend of the connection")
+	}
+	if err := pool.PutConnection(ctx, conn); err != nil {
+		t.Fatalf("PutConnection() error = %v", err)
+	}
+	if first.connCount() != 0 {
+		t.Fatal("connection was not returned to its backend")
+	}
+
+	// The first backend has no connections left, so it is picked again.
+	if _, err := pool.GetConnection(ctx); err != nil {
+		t.Fatalf("GetConnection() error = %v", err)
+	}
+	if first.connCount() != 1 {
+		t.Errorf("first backend has %d connections, want 1", first.connCount())
+	}
+}
+
+func TestWakeUpFallsBack(t *testing.T) {
+	primary, fallback := &fakeConnector{startErr: errStart}, &fakeConnector{}
+	pool := newPool(t, FirstAvailable, primary, fallback)
+
+	if err := pool.WakeUp(context.Background()); err != nil {
+		t.Fatalf("WakeUp() error = %v", err)
+	}
+	testutil.Eventually(t, fallback.ServerUp, "fallback backend was not started")
+	if fallback.connCount() != 0 {
+		t.Error("WakeUp() connected to a backend")
+	}
+}
+
+func TestFailoverOnlyOnStartFailures(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		wantFailover bool
+	}{
+		{name: "start timeout", err: errStart, wantFailover: true},
+		{name: "crashed", err: fmt.Errorf("%w: in backoff", connector.ErrServerCrashed), wantFailover: true},
+		{name: "not permitted", err: fmt.Errorf("%w: forbidden", connector.ErrNotPermitted)},
+		{name: "rate limited", err: fmt.Errorf("%w: too many requests", connector.ErrRateLimited)},
+		{name: "not found", err: fmt.Errorf("%w: unknown server", connector.ErrServerNotFound)},
+		{name: "dial failed", err: errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary, fallback := &fakeConnector{startErr: tt.err}, &fakeConnector{}
+			pool := newPool(t, FirstAvailable, primary, fallback)
+
+			_, err := pool.GetConnection(context.Background())
+			if tt.wantFailover {
+				if err != nil {
+					t.Fatalf("GetConnection() error = %v", err)
+				}
+				if fallback.connCount() != 1 {
+					t.Errorf("fallback has %d connections, want 1", fallback.connCount())
+				}
+				return
+			}
+			if !errors.Is(err, tt.err) || errors.Is(err, ErrNoBackend) {
+				t.Fatalf("GetConnection() error = %v, want %v as is", err, tt.err)
+			}
+			if starts := fallback.startCount(); starts != 0 {
+				t.Errorf("fallback started %d times, want 0", starts)
+			}
+		})
+	}
+}
+
+func TestStatusConnectionNeverFailsOver(t *testing.T) {
+	primary, fallback := &fakeConnector{startErr: errStart}, &fakeConnector{}
+	pool := newPool(t, FirstAvailable, primary, fallback)
+
+	if _, err := pool.GetStatusConnection(context.Background()); !errors.Is(err, errStart) {
+		t.Fatalf("GetStatusConnection() error = %v, want %v", err, errStart)
+	}
+	if starts := fallback.startCount(); starts != 0 {
+		t.Errorf("fallback started %d times, want 0", starts)
+	}
+}
+
+func TestBackendAddress(t *testing.T) {
+	primary, fallback := &fakeConnector{startErr: errStart}, &fakeConnector{}
+	pool := newPool(t, FirstAvailable, primary, fallback)
+
+	conn, err := pool.GetConnection(context.Background())
+	if err != nil {
+		t.Fatalf("GetConnection() error = %v", err)
+	}
+	if address, ok := pool.BackendAddress(conn); !ok || address != "b" {
+		t.Errorf("BackendAddress() = %q, %t, want %q, true", address, ok, "b")
+	}
+}
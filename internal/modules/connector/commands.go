@@ -0,0 +1,247 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrNoShutdownScheduled is returned when a shutdown command finds no pending shutdown.
+	ErrNoShutdownScheduled = errors.New("no shutdown scheduled")
+	// ErrServerStopped is returned to requests waiting for a server that was stopped by a command.
+	ErrServerStopped = errors.New("server stopped")
+	// ErrNotRunning is returned when the server is asked to stop while it is neither running nor being started.
+	ErrNotRunning = errors.New("server is not running")
+)
+
+// command is an administrative action executed on the loop goroutine,
+// so the state machine is only ever changed by the loop.
+type command struct {
+	run   func(ctx context.Context) error
+	reply chan error
+}
+
+// execute runs the given action on the loop goroutine and waits for its result.
+func (cc *Connector) execute(ctx context.Context, run func(ctx context.Context) error) error {
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, cc.dialTimeout)
+	defer cancel()
+
+	cmd := command{run: run, reply: make(chan error, 1)}
+	select {
+	case <-ctxWithTimeout.Done():
+		return context.Canceled
+	case cc.commandCh <- cmd:
+	}
+
+	select {
+	case <-ctxWithTimeout.Done():
+		return context.Canceled
+	case err := <-cmd.reply:
+		return err
+	}
+}
+
+// PlayerJoined reports that the player of a login connection made it past the login phase,
+// so the player is counted until the connection is returned.
+func (cc *Connector) PlayerJoined(ctx context.Context, conn net.Conn) error {
+	return cc.execute(ctx, func(context.Context) error {
+		cc.playerJoined(conn)
+		return nil
+	})
+}
+
+// StartServer starts the Minecraft server and waits for it to come up.
+// Without players joining, the server is shut down again after the idle timeout.
+func (cc *Connector) StartServer(ctx context.Context) error {
+	_, err := cc.request(ctx, &request{wake: true})
+	return err
+}
+
+// StopServer stops the Minecraft server regardless of connected players, who are only warned by the RCON countdown.
+// Requests waiting for the server to come up fail with ErrServerStopped, and a start already sent to the server
+// is followed by a stop. The stop runs off the loop goroutine; connection requests made meanwhile start the server
+// again afterwards. ErrNotRunning is returned if the server is off and not being started.
+func (cc *Connector) StopServer(ctx context.Context) error {
+	done := make(chan error, 1)
+	err := cc.execute(ctx, func(loopCtx context.Context) error {
+		previous := cc.getState()
+		switch {
+		case previous == stateStopping:
+			done <- nil
+			return nil
+		case (previous == stateOff || previous == stateCrashed) && cc.busy:
+			// The start request is already on its way, so the server is stopped once it has been started.
+			cc.failWaiters(ErrServerStopped)
+			cc.stopOnStart = true
+			done <- nil
+			return nil
+		case previous == stateOff:
+			return ErrNotRunning
+		}
+		cc.stop(loopCtx, previous, done)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return context.Canceled
+	case err := <-done:
+		return err
+	}
+}
+
+// stop moves to Stopping and stops the server off the loop goroutine, going back to previous if that fails.
+// The result is sent to done, unless it is nil.
+func (cc *Connector) stop(ctx context.Context, previous state, done chan<- error) {
+	cc.serverOperator.StopShuttingDown()
+	if cc.cancelAwait != nil {
+		cc.cancelAwait()
+	}
+	cc.failWaiters(ErrServerStopped)
+	cc.setState(stateStopping)
+	cc.async(ctx, func() func() {
+		err := cc.serverOperator.StopMinecraftServer(ctx)
+		return func() {
+			if err != nil {
+				cc.setState(previous)
+				cc.recordError(err)
+			} else {
+				cc.setState(stateOff)
+				cc.transitioned()
+			}
+			if done != nil {
+				done <- err
+			}
+			cc.advance(ctx)
+		}
+	})
+}
+
+// CancelShutdown cancels the pending shutdown. The server keeps running until players join and leave again.
+func (cc *Connector) CancelShutdown(ctx context.Context) error {
+	return cc.execute(ctx, func(context.Context) error {
+		if _, scheduled := cc.serverOperator.ShutdownDeadline(); !scheduled {
+			return ErrNoShutdownScheduled
+		}
+		cc.serverOperator.StopShuttingDown()
+		cc.idleCancelled = true
+		return nil
+	})
+}
+
+// ReportIdle reports whether the in-game player count reads zero, for the ShutdownOnIdle mode.
+// An idle server gets a shutdown scheduled after the shutdown timeout, like an empty one in ShutdownOnEmpty
+// mode, and players coming back cancel it. A shutdown cancelled by CancelShutdown is not scheduled again
+// before players have come back.
+func (cc *Connector) ReportIdle(ctx context.Context, idle bool) error {
+	return cc.execute(ctx, func(context.Context) error {
+		if !idle {
+			cc.idleCancelled = false
+			cc.serverOperator.StopShuttingDown()
+			return nil
+		}
+		if !cc.autoshutdown.Load() || !cc.ServerUp() || cc.idleCancelled {
+			return nil
+		}
+		if _, scheduled := cc.serverOperator.ShutdownDeadline(); !scheduled {
+			cc.serverOperator.ScheduleShutdown(cc.shutdownCh, cc.done)
+		}
+		return nil
+	})
+}
+
+// ExtendShutdown postpones the pending shutdown by extra.
+func (cc *Connector) ExtendShutdown(ctx context.Context, extra time.Duration) error {
+	return cc.execute(ctx, func(context.Context) error {
+		if !cc.serverOperator.ExtendShutdown(extra) {
+			return ErrNoShutdownScheduled
+		}
+		return nil
+	})
+}
+
+// SetAutoShutdown enables or disables shutting the server down when it becomes empty.
+// Disabling it cancels the pending shutdown, enabling it schedules one if the server is already empty.
+func (cc *Connector) SetAutoShutdown(ctx context.Context, enabled bool) error {
+	return cc.execute(ctx, func(context.Context) error {
+		cc.autoshutdown.Store(enabled)
+		if !enabled {
+			cc.serverOperator.StopShuttingDown()
+			return nil
+		}
+		if _, scheduled := cc.serverOperator.ShutdownDeadline(); !scheduled && cc.getState() == stateEmpty && cc.shutdownOnEmpty() {
+			cc.serverOperator.ScheduleShutdown(cc.shutdownCh, cc.done)
+		}
+		return nil
+	})
+}
+
+// Observe corrects the connector from the server state reported by the control panel,
+// picking up servers that were started, stopped or joined without going through the proxy.
+// The reported state lags behind, so it is ignored while the server is starting or stopping,
+// and for a grace period after the connector started or stopped the server.
+func (cc *Connector) Observe(ctx context.Context, running bool, players int) error {
+	return cc.execute(ctx, func(loopCtx context.Context) error {
+		state := cc.getState()
+		if state == stateStartingUp || state == stateStopping || time.Now().Before(cc.observeAfter) {
+			cc.logger.Debug("Ignoring MC server state reported while the connector changes it")
+			return nil
+		}
+
+		atomic.StoreInt32(&cc.observedPlayers, int32(players)) //nolint:gosec
+		proxied := atomic.LoadInt32(&cc.playerCount)
+
+		switch {
+		case !running && (state == stateEmpty || state == stateRunning):
+			cc.logger.Info("MC server was stopped outside the proxy")
+			cc.serverOperator.StopShuttingDown()
+			cc.setState(stateOff)
+		case running && (state == stateOff || state == stateCrashed):
+			cc.logger.Info("MC server was started outside the proxy")
+			cc.crashes = 0
+			cc.idleCancelled = false
+			if players > 0 {
+				cc.setState(stateRunning)
+			} else {
+				cc.shutdownMiddleware()
+			}
+		case running && state == stateEmpty && players > 0:
+			cc.serverOperator.StopShuttingDown()
+			cc.setState(stateRunning)
+		case running && state == stateRunning && players == 0 && proxied == 0 && len(cc.logins) == 0:
+			cc.shutdownMiddleware()
+		}
+		cc.advance(loopCtx)
+		return nil
+	})
+}
+
+// AutoShutdown reports whether the server is shut down when it becomes empty.
+func (cc *Connector) AutoShutdown() bool {
+	return cc.autoshutdown.Load()
+}
+
+// ShutdownDeadline returns the time of the pending shutdown, if there is one.
+func (cc *Connector) ShutdownDeadline() (time.Time, bool) {
+	return cc.serverOperator.ShutdownDeadline()
+}
+
+// LastError returns the most recent error of a server start, stop or connection attempt.
+func (cc *Connector) LastError() error {
+	cc.errMu.Lock()
+	defer cc.errMu.Unlock()
+	return cc.lastErr
+}
+
+// recordError remembers err as the most recent error.
+func (cc *Connector) recordError(err error) {
+	cc.errMu.Lock()
+	defer cc.errMu.Unlock()
+	cc.lastErr = err
+}
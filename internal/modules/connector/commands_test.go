@@ -0,0 +1,251 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/testutil"
+)
+
+func TestStartAndStopServer(t *testing.T) {
+	op := &fakeOperator{}
+	cc := startConnector(t, op, time.Second)
+	ctx := context.Background()
+
+	if err := cc.StartServer(ctx); err != nil {
+		t.Fatalf("StartServer() error = %v", err)
+	}
+	if !cc.ServerUp() {
+		t.Fatal("server is not up after StartServer()")
+	}
+	if len(op.dialed()) != 0 {
+		t.Error("StartServer() dialed the server")
+	}
+
+	if err := cc.StopServer(ctx); err != nil {
+		t.Fatalf("StopServer() error = %v", err)
+	}
+	if state := cc.getState(); state != stateOff {
+		t.Errorf("state = %s, want %s", String(state), String(stateOff))
+	}
+	if op.shutdownScheduled() {
+		t.Error("shutdown still scheduled after StopServer()")
+	}
+}
+
+func TestStopServerFailureRestoresState(t *testing.T) {
+	errStop := errors.New("stop failed")
+	op := &fakeOperator{running: true, stopErr: errStop}
+	cc := startConnector(t, op, time.Second)
+	testutil.Eventually(t, cc.ServerUp, "server is not up")
+
+	if err := cc.StopServer(context.Background()); !errors.Is(err, errStop) {
+		t.Fatalf("StopServer() error = %v, want %v", err, errStop)
+	}
+	if state := cc.getState(); state != stateEmpty {
+		t.Errorf("state = %s, want %s", String(state), String(stateEmpty))
+	}
+}
+
+func TestStopServerWhileStarting(t *testing.T) {
+	op := &fakeOperator{awaitGate: make(chan struct{})}
+	t.Cleanup(func() { close(op.awaitGate) })
+	cc := startConnector(t, op, time.Second)
+
+	if err := cc.WakeUp(context.Background()); err != nil {
+		t.Fatalf("WakeUp() error = %v", err)
+	}
+	testutil.Eventually(t, func() bool { return cc.getState() == stateStartingUp }, "server is not starting up")
+
+	if err := cc.StopServer(context.Background()); err != nil {
+		t.Fatalf("StopServer() error = %v", err)
+	}
+	if state := cc.getState(); state != stateOff {
+		t.Errorf("state = %s, want %s", String(state), String(stateOff))
+	}
+}
+
+func TestStopServerWhenOff(t *testing.T) {
+	op := &fakeOperator{}
+	cc := startConnector(t, op, time.Second)
+
+	if err := cc.StopServer(context.Background()); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("StopServer() error = %v, want %v", err, ErrNotRunning)
+	}
+	if stops := op.stopCount(); stops != 0 {
+		t.Errorf("server stopped %d times, want 0", stops)
+	}
+}
+
+func TestStopServerCancelsPendingStart(t *testing.T) {
+	op := &fakeOperator{startGate: make(chan struct{})}
+	cc := startConnector(t, op, time.Second)
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := cc.GetConnection(context.Background())
+		result <- err
+	}()
+	testutil.Eventually(t, func() bool { return waiterCount(t, cc) == 1 }, "request is not waiting for the server")
+
+	// The start request has not reached the server yet, so the connector is still off.
+	if err := cc.StopServer(context.Background()); err != nil {
+		t.Fatalf("StopServer() error = %v", err)
+	}
+	if err := <-result; !errors.Is(err, ErrServerStopped) {
+		t.Fatalf("GetConnection() error = %v, want %v", err, ErrServerStopped)
+	}
+
+	close(op.startGate)
+	testutil.Eventually(t, func() bool { return op.stopCount() == 1 }, "server was not stopped after the start")
+	testutil.Eventually(t, func() bool { return cc.getState() == stateOff }, "server is not off")
+	if op.IsServerRunning() {
+		t.Error("server is running after the cancelled start")
+	}
+}
+
+func TestShutdownCommands(t *testing.T) {
+	op := &fakeOperator{running: true}
+	cc := startConnector(t, op, time.Second)
+	ctx := context.Background()
+	testutil.Eventually(t, op.shutdownScheduled, "shutdown was not scheduled for the empty server")
+
+	if err := cc.ExtendShutdown(ctx, time.Minute); err != nil {
+		t.Fatalf("ExtendShutdown() error = %v", err)
+	}
+	if err := cc.CancelShutdown(ctx); err != nil {
+		t.Fatalf("CancelShutdown() error = %v", err)
+	}
+	if err := cc.CancelShutdown(ctx); !errors.Is(err, ErrNoShutdownScheduled) {
+		t.Fatalf("CancelShutdown() error = %v, want %v", err, ErrNoShutdownScheduled)
+	}
+
+	if err := cc.SetAutoShutdown(ctx, false); err != nil {
+		t.Fatalf("SetAutoShutdown(false) error = %v", err)
+	}
+	if cc.AutoShutdown() {
+		t.Fatal("AutoShutdown() = true after disabling it")
+	}
+	if err := cc.SetAutoShutdown(ctx, true); err != nil {
+		t.Fatalf("SetAutoShutdown(true) error = %v", err)
+	}
+	if !op.shutdownScheduled() {
+		t.Error("enabling auto shutdown did not schedule a shutdown for the empty server")
+	}
+}
+
+func TestReportIdle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	op := &fakeOperator{running: true}
+	cc := New(testutil.Logger{T: t}, true, ShutdownOnIdle, op, time.Second)
+	cc.StartLoop(ctx)
+
+	steps := []struct {
+		name   string
+		action func() error
+		want   bool
+	}{
+		{name: "idle", action: func() error { return cc.ReportIdle(ctx, true) }, want: true},
+		{name: "players back", action: func() error { return cc.ReportIdle(ctx, false) }, want: false},
+		{name: "idle again", action: func() error { return cc.ReportIdle(ctx, true) }, want: true},
+		{name: "cancelled", action: func() error { return cc.CancelShutdown(ctx) }, want: false},
+		{name: "idle after cancel", action: func() error { return cc.ReportIdle(ctx, true) }, want: false},
+		{name: "players back after cancel", action: func() error { return cc.ReportIdle(ctx, false) }, want: false},
+		{name: "idle after players left", action: func() error { return cc.ReportIdle(ctx, true) }, want: true},
+	}
+	if op.shutdownScheduled() {
+		t.Fatal("shutdown was scheduled before the server was reported idle")
+	}
+	for _, step := range steps {
+		if err := step.action(); err != nil {
+			t.Fatalf("%s: error = %v", step.name, err)
+		}
+		if got := op.shutdownScheduled(); got != step.want {
+			t.Errorf("%s: shutdown scheduled = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestObserve(t *testing.T) {
+	op := &fakeOperator{}
+	cc := startConnector(t, op, time.Second)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		running bool
+		players int
+		want    state
+	}{
+		{name: "started outside the proxy", running: true, players: 0, want: stateEmpty},
+		{name: "joined outside the proxy", running: true, players: 2, want: stateRunning},
+		{name: "left outside the proxy", running: true, players: 0, want: stateEmpty},
+		{name: "stopped outside the proxy", running: false, players: 0, want: stateOff},
+	}
+	for _, tt := range tests {
+		if err := cc.Observe(ctx, tt.running, tt.players); err != nil {
+			t.Fatalf("%s: Observe() error = %v", tt.name, err)
+		}
+		if state := cc.getState(); state != tt.want {
+			t.Errorf("%s: state = %s, want %s", tt.name, String(state), String(tt.want))
+		}
+		if count := cc.PlayerCount(); count != tt.players {
+			t.Errorf("%s: PlayerCount() = %d, want %d", tt.name, count, tt.players)
+		}
+	}
+}
+
+func TestObserveIgnoresStaleState(t *testing.T) {
+	op := &fakeOperator{}
+	cc := startConnector(t, op, time.Second)
+	ctx := context.Background()
+
+	if err := cc.StartServer(ctx); err != nil {
+		t.Fatalf("StartServer() error = %v", err)
+	}
+	testutil.Eventually(t, op.shutdownScheduled, "shutdown was not scheduled for the empty server")
+	// The control panel still reports the server as stopped right after the start.
+	if err := cc.Observe(ctx, false, 0); err != nil {
+		t.Fatalf("Observe() error = %v", err)
+	}
+	if state := cc.getState(); state != stateEmpty {
+		t.Errorf("state after a stale stop = %s, want %s", String(state), String(stateEmpty))
+	}
+	if !op.shutdownScheduled() {
+		t.Error("stale stop cancelled the scheduled shutdown")
+	}
+
+	if err := cc.StopServer(ctx); err != nil {
+		t.Fatalf("StopServer() error = %v", err)
+	}
+	// And as running right after the stop.
+	if err := cc.Observe(ctx, true, 3); err != nil {
+		t.Fatalf("Observe() error = %v", err)
+	}
+	if state := cc.getState(); state != stateOff {
+		t.Errorf("state after a stale start = %s, want %s", String(state), String(stateOff))
+	}
+}
+
+func TestObserveIgnoresStateWhileStarting(t *testing.T) {
+	op := &fakeOperator{awaitGate: make(chan struct{})}
+	t.Cleanup(func() { close(op.awaitGate) })
+	cc := startConnector(t, op, time.Second)
+
+	if err := cc.WakeUp(context.Background()); err != nil {
+		t.Fatalf("WakeUp() error = %v", err)
+	}
+	testutil.Eventually(t, func() bool { return cc.getState() == stateStartingUp }, "server is not starting up")
+
+	for _, running := range []bool{false, true} {
+		if err := cc.Observe(context.Background(), running, 0); err != nil {
+			t.Fatalf("Observe(%t) error = %v", running, err)
+		}
+		if state := cc.getState(); state != stateStartingUp {
+			t.Errorf("Observe(%t): state = %s, want %s", running, String(state), String(stateStartingUp))
+		}
+	}
+}
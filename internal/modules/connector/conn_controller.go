@@ -3,11 +3,27 @@ package connector
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
+const (
+	// rateLimitCooldown is how long the connector waits before starting the server again after being rate limited.
+	rateLimitCooldown = 30 * time.Second
+	// crashBackoff is how long the connector waits before starting the server again after its first crash.
+	// The wait doubles with every further crash, up to maxCrashBackoff.
+	crashBackoff = 30 * time.Second
+	// maxCrashBackoff caps the wait before starting a crashed server again.
+	maxCrashBackoff = 10 * time.Minute
+	// observeGrace is how long the server state reported by the control panel is ignored after the connector
+	// started or stopped the server, as the reported state lags behind.
+	observeGrace = time.Minute
+)
+
 // Logger defines the logging interface used throughout the Connector.
 type Logger interface {
 	Debug(format string, args ...any)
@@ -18,14 +34,29 @@ type Logger interface {
 
 // ServerOperator defines the interface to manage the lifecycle of a Minecraft server.
 type ServerOperator interface {
-	StartMinecraftServer() error
+	StartMinecraftServer(ctx context.Context) error
+	StopMinecraftServer(ctx context.Context) error
 	IsServerRunning() bool
 	ConnectToServer() (net.Conn, error)
 	AwaitForServerStart(ctx context.Context) error
-	ScheduleShutdown(shutdownEmitter chan<- struct{})
+	ScheduleShutdown(events chan<- ShutdownEvent, done <-chan struct{})
 	StopShuttingDown()
+	ShutdownDeadline() (time.Time, bool)
+	ExtendShutdown(extra time.Duration) bool
 }
 
+// ShutdownEvent reports the progress of a scheduled shutdown to the connector.
+type ShutdownEvent int
+
+const (
+	// ShutdownStarted is sent when the server is about to be stopped.
+	ShutdownStarted ShutdownEvent = iota
+	// ShutdownCompleted is sent when the server has been stopped.
+	ShutdownCompleted
+	// ShutdownFailed is sent when the server could not be stopped and keeps running.
+	ShutdownFailed
+)
+
 // ConnConfig represents the configuration required to establish a connection.
 type ConnConfig struct {
 	Protocol    string
@@ -38,59 +69,115 @@ type connPackage struct {
 	err  error
 }
 
+// request asks the loop for a connection to the server, or only for the server to be up.
+type request struct {
+	login bool             // Whether the connection is for a player logging in
+	wake  bool             // Whether only the server start is requested, without a connection
+	reply chan connPackage // Buffered, so the loop never blocks on it; nil if nobody waits for the result
+
+	// settled is set by whichever side finishes the request first: the loop when it replies,
+	// or the caller when it gives up. A reply to an abandoned request is rolled back.
+	settled atomic.Bool
+}
+
 // Connector handles player connections to the Minecraft server,
 // managing server state and lifecycle transitions based on connection requests.
 type Connector struct {
-	playerCount    int
-	autoshutdown   bool
-	state          state
-	dialTimeout    time.Duration
-	logger         Logger
-	serverOperator ServerOperator
-	getConnCh      chan struct{}
-	shutdownCh     chan struct{}
-	connCh         chan connPackage
-	putConnCh      chan net.Conn
+	playerCount     int32
+	observedPlayers int32
+	autoshutdown    atomic.Bool
+	shutdownMode    ShutdownMode
+	state           state
+	dialTimeout     time.Duration
+	logger          Logger
+	serverOperator  ServerOperator
+	requestCh       chan *request
+	resultCh        chan func()
+	commandCh       chan command
+	shutdownCh      chan ShutdownEvent
+	putConnCh       chan net.Conn
+	done            <-chan struct{} // Closed once the loop has exited, so shutdown events are no longer sent
+
+	// Only accessed by the loop goroutine.
+	waiters           []*request         // Requests waiting for the server to come up
+	busy              bool               // Whether a start or an await is in progress
+	cancelAwait       context.CancelFunc // Cancels the await in progress, if any
+	stopOnStart       bool               // Whether the start in progress is followed by a stop
+	startBlockedUntil time.Time
+	crashes           int               // Consecutive failed starts
+	crashRetryAt      time.Time         // Time a crashed server may be started again
+	logins            map[net.Conn]bool // Login sessions, true once the player has joined
+	observeGrace      time.Duration
+	observeAfter      time.Time // Observations before this time are ignored
+	idleCancelled     bool      // Whether the shutdown of the idle server was cancelled by a command
+
+	errMu   sync.Mutex
+	lastErr error
 }
 
 // New creates and initializes a new Connector instance.
-func New(logger Logger, autoshutdown bool, serverOperator ServerOperator, dialTimeout time.Duration) *Connector {
-	return &Connector{
+func New(logger Logger, autoshutdown bool, shutdownMode ShutdownMode, serverOperator ServerOperator, dialTimeout time.Duration) *Connector {
+	cc := &Connector{
 		playerCount:    0,
-		autoshutdown:   autoshutdown,
+		shutdownMode:   shutdownMode,
 		state:          stateOff,
 		dialTimeout:    dialTimeout,
 		logger:         logger,
 		serverOperator: serverOperator,
-		getConnCh:      make(chan struct{}),
-		shutdownCh:     make(chan struct{}),
-		connCh:         make(chan connPackage),
+		requestCh:      make(chan *request),
+		resultCh:       make(chan func()),
+		commandCh:      make(chan command),
+		shutdownCh:     make(chan ShutdownEvent),
 		putConnCh:      make(chan net.Conn),
+		logins:         make(map[net.Conn]bool),
+		observeGrace:   observeGrace,
 	}
+	cc.autoshutdown.Store(autoshutdown)
+	return cc
 }
 
-// GetConnection requests a connection to the Minecraft server.
-// If the server is off, it will be started and waited on.
+// GetConnection requests a connection to the Minecraft server for a player logging in.
+// If the server is off, it will be started and waited on. A pending shutdown is cancelled,
+// but the player only counts once PlayerJoined reports that the login succeeded.
 func (cc *Connector) GetConnection(ctx context.Context) (net.Conn, error) {
+	return cc.request(ctx, &request{login: true})
+}
+
+// GetStatusConnection requests a connection to the Minecraft server for a server list ping.
+// If the server is off, it will be started and waited on. Status sessions neither count as players
+// nor keep the server from shutting down.
+func (cc *Connector) GetStatusConnection(ctx context.Context) (net.Conn, error) {
+	return cc.request(ctx, &request{})
+}
+
+// request queues req on the loop and waits for its result.
+// If the caller gives up first, the loop closes the connection it dials for the request.
+func (cc *Connector) request(ctx context.Context, req *request) (net.Conn, error) {
 	ctxWithTimeout, cancel := context.WithTimeout(ctx, cc.dialTimeout)
 	defer cancel()
 
+	req.reply = make(chan connPackage, 1)
 	select {
 	case <-ctxWithTimeout.Done():
 		return nil, context.Canceled
-	case cc.getConnCh <- struct{}{}:
+	case cc.requestCh <- req:
 	}
 
 	select {
 	case <-ctxWithTimeout.Done():
-		return nil, context.Canceled
-	case conn := <-cc.connCh:
+		if req.settled.CompareAndSwap(false, true) {
+			return nil, context.Canceled
+		}
+		// The loop settled the request first, so its reply is already on the way.
+		conn := <-req.reply
+		return conn.conn, conn.err
+	case conn := <-req.reply:
 		return conn.conn, conn.err
 	}
 }
 
 // PutConnection returns a connection (usually when the player disconnects).
-// If no players remain, a shutdown is scheduled.
+// If no players or logins remain, a shutdown is scheduled.
 func (cc *Connector) PutConnection(ctx context.Context, conn net.Conn) error {
 	ctxWithTimeout, cancel := context.WithTimeout(ctx, cc.dialTimeout)
 	defer cancel()
@@ -103,9 +190,45 @@ func (cc *Connector) PutConnection(ctx context.Context, conn net.Conn) error {
 	}
 }
 
+// WakeUp asks the connector to start the Minecraft server without connecting to it.
+// It returns as soon as the request is accepted; the server is started in the background.
+func (cc *Connector) WakeUp(ctx context.Context) error {
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, cc.dialTimeout)
+	defer cancel()
+
+	select {
+	case <-ctxWithTimeout.Done():
+		return context.Canceled
+	case cc.requestCh <- &request{wake: true}:
+		return nil
+	}
+}
+
+// ServerUp reports whether the server is running, with or without players.
+func (cc *Connector) ServerUp() bool {
+	state := cc.getState()
+	return state == stateEmpty || state == stateRunning
+}
+
+// ServerState returns the human-readable name of the current server state.
+func (cc *Connector) ServerState() string {
+	return String(cc.getState())
+}
+
+// PlayerCount returns the number of players on the server: those who joined through the connector,
+// or the number last reported by Crafty if that is higher.
+func (cc *Connector) PlayerCount() int {
+	return int(max(atomic.LoadInt32(&cc.playerCount), atomic.LoadInt32(&cc.observedPlayers)))
+}
+
 // StartLoop begins the main loop that handles connection and disconnection events.
 // This method should be called once at application startup.
+//
+// The loop never waits for the server itself: starting, awaiting and stopping the server run on their own
+// goroutines and report back through resultCh, so disconnects, shutdown events and commands are handled
+// while a slow start is in progress.
 func (cc *Connector) StartLoop(ctx context.Context) {
+	cc.done = ctx.Done()
 	if cc.serverOperator.IsServerRunning() {
 		cc.shutdownMiddleware()
 	}
@@ -115,62 +238,289 @@ func (cc *Connector) StartLoop(ctx context.Context) {
 			select {
 			case <-ctx.Done():
 				return
-			case <-cc.getConnCh:
-				conn, err := cc.processState(ctx)
-				cc.connCh <- connPackage{conn: conn, err: err}
+			case req := <-cc.requestCh:
+				cc.waiters = append(cc.waiters, req)
+				cc.advance(ctx)
+			case apply := <-cc.resultCh:
+				apply()
+			case cmd := <-cc.commandCh:
+				cmd.reply <- cmd.run(ctx)
 			case conn := <-cc.putConnCh:
-				if conn != nil {
-					cc.playerCount--
-					if cc.playerCount == 0 {
-						cc.shutdownMiddleware()
-					}
-					conn.Close()
-				}
-			case <-cc.shutdownCh:
-				if cc.getState() == stateEmpty {
-					cc.setState(stateOff)
-				}
+				cc.releaseConnection(conn)
+			case event := <-cc.shutdownCh:
+				cc.handleShutdownEvent(event)
+				cc.advance(ctx)
 			}
 		}
 	}()
 }
 
-// processState transitions through the server's lifecycle states until a connection is established.
-func (cc *Connector) processState(ctx context.Context) (net.Conn, error) {
-	for {
-		switch cc.getState() {
-		case stateOff:
-			if err := cc.serverOperator.StartMinecraftServer(); err != nil {
-				return nil, err
+// advance moves the state machine towards serving the queued requests.
+// At most one start or await is in progress; its result calls advance again.
+func (cc *Connector) advance(ctx context.Context) {
+	if len(cc.waiters) == 0 || cc.busy {
+		return
+	}
+
+	switch cc.getState() {
+	case stateOff, stateCrashed:
+		if err := cc.startAllowed(); err != nil {
+			cc.recordError(err)
+			cc.failWaiters(err)
+			return
+		}
+		cc.busy = true
+		cc.async(ctx, func() func() {
+			err := cc.serverOperator.StartMinecraftServer(ctx)
+			return func() {
+				cc.busy = false
+				cc.started(ctx, err)
 			}
-			cc.setState(stateStartingUp)
-		case stateStartingUp:
-			if err := cc.serverOperator.AwaitForServerStart(ctx); err != nil {
-				return nil, err
+		})
+	case stateStartingUp:
+		cc.busy = true
+		awaitCtx, cancel := context.WithCancel(ctx)
+		cc.cancelAwait = cancel
+		cc.async(ctx, func() func() {
+			err := cc.serverOperator.AwaitForServerStart(awaitCtx)
+			return func() {
+				cancel()
+				cc.busy = false
+				cc.cancelAwait = nil
+				cc.awaited(ctx, err)
 			}
-			cc.setState(stateEmpty)
-		case stateEmpty:
-			cc.serverOperator.StopShuttingDown()
-			cc.setState(stateRunning)
-		case stateRunning:
-			serverConnection, err := cc.serverOperator.ConnectToServer()
+		})
+	case stateStopping:
+		// The waiters are served once the stop has completed.
+	case stateEmpty, stateRunning:
+		waiters := cc.waiters
+		cc.waiters = nil
+		for _, req := range waiters {
+			cc.serve(ctx, req)
+		}
+	}
+}
+
+// async runs op on its own goroutine and applies the function it returns on the loop goroutine.
+func (cc *Connector) async(ctx context.Context, op func() func()) {
+	go func() {
+		apply := op()
+		select {
+		case <-ctx.Done():
+		case cc.resultCh <- apply:
+		}
+	}()
+}
+
+// serve answers a request for a running server. Connections are dialed off the loop goroutine.
+// Login connections are tracked until they are returned and cancel a pending shutdown.
+func (cc *Connector) serve(ctx context.Context, req *request) {
+	if req.wake {
+		cc.reply(req, nil, nil)
+		return
+	}
+
+	cc.async(ctx, func() func() {
+		serverConnection, err := cc.serverOperator.ConnectToServer()
+		return func() {
 			if err != nil {
-				cc.setState(stateOff)
-				return nil, err
+				if cc.ServerUp() {
+					cc.setState(stateOff)
+				}
+				cc.recordError(err)
+				cc.reply(req, nil, err)
+				return
+			}
+			if req.login {
+				cc.serverOperator.StopShuttingDown()
+				cc.logins[serverConnection] = false
 			}
-			cc.playerCount++
-			return serverConnection, nil
+			cc.reply(req, serverConnection, nil)
+		}
+	})
+}
+
+// reply sends the result of a request to its caller, or logs a failed wake-up nobody waits for.
+// If the caller has given up, the connection is released as if it had been returned.
+func (cc *Connector) reply(req *request, conn net.Conn, err error) {
+	if req.reply == nil {
+		if err != nil {
+			cc.logger.Error("Failed to wake up MC server: %v", err)
+		}
+		return
+	}
+	if !req.settled.CompareAndSwap(false, true) {
+		if conn != nil {
+			cc.logger.Debug("Closing connection to MC server, the request was abandoned")
+			cc.releaseConnection(conn)
+		}
+		return
+	}
+	req.reply <- connPackage{conn: conn, err: err}
+}
+
+// failWaiters fails every queued request with err.
+func (cc *Connector) failWaiters(err error) {
+	for _, req := range cc.waiters {
+		cc.reply(req, nil, err)
+	}
+	cc.waiters = nil
+}
+
+// playerJoined counts the player of a login connection and marks the server as running.
+func (cc *Connector) playerJoined(conn net.Conn) {
+	if joined, ok := cc.logins[conn]; !ok || joined {
+		return
+	}
+	cc.logins[conn] = true
+	atomic.AddInt32(&cc.playerCount, 1)
+	if cc.getState() == stateEmpty {
+		cc.setState(stateRunning)
+	}
+}
+
+// releaseConnection closes a returned connection and schedules a shutdown
+// once neither joined players nor logins in progress remain.
+func (cc *Connector) releaseConnection(conn net.Conn) {
+	if conn == nil {
+		return
+	}
+	conn.Close()
+
+	joined, ok := cc.logins[conn]
+	if !ok {
+		return
+	}
+	delete(cc.logins, conn)
+	if joined {
+		atomic.AddInt32(&cc.playerCount, -1)
+	}
+
+	state := cc.getState()
+	if len(cc.logins) == 0 && atomic.LoadInt32(&cc.observedPlayers) == 0 && (state == stateEmpty || state == stateRunning) {
+		cc.shutdownMiddleware()
+	}
+}
+
+// handleShutdownEvent moves through Stopping as a scheduled shutdown progresses.
+func (cc *Connector) handleShutdownEvent(event ShutdownEvent) {
+	state := cc.getState()
+	switch event {
+	case ShutdownStarted:
+		if state == stateEmpty || state == stateRunning {
+			cc.setState(stateStopping)
+			cc.transitioned()
+		}
+	case ShutdownCompleted:
+		if state == stateStopping || state == stateEmpty {
+			cc.setState(stateOff)
+			cc.transitioned()
+		}
+	case ShutdownFailed:
+		if state == stateStopping {
+			cc.shutdownMiddleware()
+		}
+	}
+}
+
+// startAllowed returns an error if the server must not be started yet after being rate limited or crashing.
+func (cc *Connector) startAllowed() error {
+	if time.Now().Before(cc.startBlockedUntil) {
+		return fmt.Errorf("%w: not retrying before %s", ErrRateLimited, cc.startBlockedUntil.Format(time.TimeOnly))
+	}
+	if cc.getState() == stateCrashed && time.Now().Before(cc.crashRetryAt) {
+		return fmt.Errorf("%w: not retrying before %s", ErrServerCrashed, cc.crashRetryAt.Format(time.TimeOnly))
+	}
+	return nil
+}
+
+// started handles the result of a start request and moves to StartingUp.
+// A server that turns out to be running already is awaited like a freshly started one.
+func (cc *Connector) started(ctx context.Context, err error) {
+	stopping := cc.stopOnStart
+	cc.stopOnStart = false
+	state := cc.getState()
+	if state != stateOff && state != stateCrashed {
+		// The state was corrected meanwhile, e.g. by the reconciler.
+		cc.advance(ctx)
+		return
+	}
+	if stopping && (err == nil || errors.Is(err, ErrServerAlreadyRunning)) {
+		cc.logger.Info("Stopping MC server, a stop was requested while it was being started")
+		cc.stop(ctx, state, nil)
+		return
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrServerAlreadyRunning):
+		cc.logger.Info("MC server is already running, waiting for it to accept connections")
+	case errors.Is(err, ErrRateLimited):
+		cc.startBlockedUntil = time.Now().Add(rateLimitCooldown)
+		cc.logger.Warn("Rate limited while starting MC server, not retrying for %s", rateLimitCooldown)
+	case errors.Is(err, ErrNotPermitted):
+		cc.logger.Error("MC server start was refused, check the Crafty credentials and permissions: %v", err)
+	case errors.Is(err, ErrServerNotFound):
+		cc.logger.Error("MC server is unknown to Crafty, check crafty_server and crafty_host: %v", err)
+	}
+	if err != nil && !errors.Is(err, ErrServerAlreadyRunning) {
+		cc.recordError(err)
+		cc.failWaiters(err)
+		return
+	}
+
+	cc.setState(stateStartingUp)
+	cc.advance(ctx)
+}
+
+// awaited handles the end of waiting for a starting server. A server that does not come up is considered
+// crashed, and is not started again before the crash backoff has passed.
+func (cc *Connector) awaited(ctx context.Context, err error) {
+	if cc.getState() != stateStartingUp {
+		cc.advance(ctx)
+		return
+	}
+
+	if err != nil {
+		cc.crashes++
+		backoff := maxCrashBackoff
+		if cc.crashes <= 10 {
+			backoff = min(crashBackoff<<(cc.crashes-1), maxCrashBackoff)
 		}
+		cc.crashRetryAt = time.Now().Add(backoff)
+		cc.setState(stateCrashed)
+		cc.logger.Error("MC server failed to start, not retrying for %s: %v", backoff, err)
+		cc.recordError(err)
+		cc.failWaiters(err)
+		return
 	}
+
+	cc.crashes = 0
+	cc.idleCancelled = false
+	cc.transitioned()
+	// Scheduled right away, so a server started by a status ping shuts down again.
+	cc.shutdownMiddleware()
+	cc.advance(ctx)
+}
+
+// transitioned starts the grace period in which observations of the server state are ignored,
+// after the connector itself has started or stopped the server.
+func (cc *Connector) transitioned() {
+	cc.observeAfter = time.Now().Add(cc.observeGrace)
 }
 
 func (cc *Connector) shutdownMiddleware() {
 	cc.setState(stateEmpty)
-	if cc.autoshutdown {
-		cc.serverOperator.ScheduleShutdown(cc.shutdownCh)
+	if cc.shutdownOnEmpty() {
+		cc.serverOperator.ScheduleShutdown(cc.shutdownCh, cc.done)
 	}
 }
 
+// shutdownOnEmpty reports whether the connector schedules a shutdown when the server becomes empty.
+func (cc *Connector) shutdownOnEmpty() bool {
+	return cc.autoshutdown.Load() && cc.shutdownMode == ShutdownOnEmpty
+}
+
 // setState updates the internal state of the connector.
 func (cc *Connector) setState(newState state) {
 	atomic.StoreInt32(&cc.state, newState)
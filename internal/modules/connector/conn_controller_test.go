@@ -0,0 +1,260 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/testutil"
+)
+
+func TestGetConnectionStartsServerOnce(t *testing.T) {
+	op := &fakeOperator{awaitGate: make(chan struct{})}
+	cc := startConnector(t, op, time.Second)
+
+	const callers = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cc.GetConnection(context.Background())
+			errs <- err
+		}()
+	}
+
+	testutil.Eventually(t, func() bool { return cc.getState() == stateStartingUp }, "server is not starting up")
+	close(op.awaitGate)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("GetConnection() error = %v", err)
+		}
+	}
+	if starts := op.startCount(); starts != 1 {
+		t.Errorf("server started %d times, want 1", starts)
+	}
+	if state := cc.getState(); state != stateEmpty {
+		t.Errorf("state = %s, want %s", String(state), String(stateEmpty))
+	}
+	if op.shutdownScheduled() {
+		t.Error("shutdown is scheduled while logins are in progress")
+	}
+}
+
+func TestLoopRespondsWhileServerStarts(t *testing.T) {
+	op := &fakeOperator{running: true, awaitGate: make(chan struct{})}
+	t.Cleanup(func() { close(op.awaitGate) })
+	cc := startConnector(t, op, time.Second)
+
+	conn, err := cc.GetConnection(context.Background())
+	if err != nil {
+		t.Fatalf("GetConnection() error = %v", err)
+	}
+	// Simulate a crash noticed by the reconciler, so the next request starts the server again.
+	if err := cc.Observe(context.Background(), false, 0); err != nil {
+		t.Fatalf("Observe() error = %v", err)
+	}
+	go func() { _, _ = cc.GetConnection(context.Background()) }()
+	testutil.Eventually(t, func() bool { return cc.getState() == stateStartingUp }, "server is not starting up")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := cc.PutConnection(ctx, conn); err != nil {
+		t.Fatalf("PutConnection() blocked while the server was starting: %v", err)
+	}
+	if err := cc.CancelShutdown(ctx); !errors.Is(err, ErrNoShutdownScheduled) {
+		t.Fatalf("CancelShutdown() error = %v, want %v", err, ErrNoShutdownScheduled)
+	}
+}
+
+func TestAbandonedRequestReleasesConnection(t *testing.T) {
+	op := &fakeOperator{running: true, connectGate: make(chan struct{})}
+	cc := startConnector(t, op, 50*time.Millisecond)
+
+	if _, err := cc.GetConnection(context.Background()); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetConnection() error = %v, want %v", err, context.Canceled)
+	}
+	close(op.connectGate)
+
+	testutil.Eventually(t, func() bool { return len(op.dialed()) == 1 && op.dialed()[0].closed.Load() },
+		"connection of the abandoned request was not closed")
+	testutil.Eventually(t, op.shutdownScheduled, "shutdown was not scheduled after the abandoned login")
+	if count := cc.PlayerCount(); count != 0 {
+		t.Errorf("PlayerCount() = %d, want 0", count)
+	}
+
+	// The loop is not wedged by the abandoned request.
+	conn, err := cc.GetConnection(context.Background())
+	if err != nil {
+		t.Fatalf("GetConnection() error = %v", err)
+	}
+	if err := cc.PutConnection(context.Background(), conn); err != nil {
+		t.Fatalf("PutConnection() error = %v", err)
+	}
+}
+
+func TestPlayerCountAndShutdownOnEmpty(t *testing.T) {
+	op := &fakeOperator{}
+	cc := startConnector(t, op, time.Second)
+	ctx := context.Background()
+
+	conn, err := cc.GetConnection(ctx)
+	if err != nil {
+		t.Fatalf("GetConnection() error = %v", err)
+	}
+	status, err := cc.GetStatusConnection(ctx)
+	if err != nil {
+		t.Fatalf("GetStatusConnection() error = %v", err)
+	}
+	if err := cc.PlayerJoined(ctx, conn); err != nil {
+		t.Fatalf("PlayerJoined() error = %v", err)
+	}
+	if err := cc.PlayerJoined(ctx, status); err != nil {
+		t.Fatalf("PlayerJoined() error = %v", err)
+	}
+	if count := cc.PlayerCount(); count != 1 {
+		t.Fatalf("PlayerCount() = %d, want 1", count)
+	}
+	if state := cc.getState(); state != stateRunning {
+		t.Fatalf("state = %s, want %s", String(state), String(stateRunning))
+	}
+
+	if err := cc.PutConnection(ctx, status); err != nil {
+		t.Fatalf("PutConnection() error = %v", err)
+	}
+	if op.shutdownScheduled() {
+		t.Fatal("shutdown scheduled while a player is online")
+	}
+	if err := cc.PutConnection(ctx, conn); err != nil {
+		t.Fatalf("PutConnection() error = %v", err)
+	}
+	testutil.Eventually(t, op.shutdownScheduled, "shutdown was not scheduled after the last player left")
+	if count := cc.PlayerCount(); count != 0 {
+		t.Errorf("PlayerCount() = %d, want 0", count)
+	}
+	if state := cc.getState(); state != stateEmpty {
+		t.Errorf("state = %s, want %s", String(state), String(stateEmpty))
+	}
+}
+
+func TestStartFailureFailsAllWaiters(t *testing.T) {
+	errStart := errors.New("start failed")
+	op := &fakeOperator{startErr: errStart, startGate: make(chan struct{})}
+	cc := startConnector(t, op, time.Second)
+
+	const callers = 3
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cc.GetConnection(context.Background())
+			errs <- err
+		}()
+	}
+	testutil.Eventually(t, func() bool { return waiterCount(t, cc) == callers }, "callers are not waiting for the start")
+	close(op.startGate)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if !errors.Is(err, errStart) {
+			t.Errorf("GetConnection() error = %v, want %v", err, errStart)
+		}
+	}
+	if !errors.Is(cc.LastError(), errStart) {
+		t.Errorf("LastError() = %v, want %v", cc.LastError(), errStart)
+	}
+	if state := cc.getState(); state != stateOff {
+		t.Errorf("state = %s, want %s", String(state), String(stateOff))
+	}
+}
+
+func TestRateLimitedStartIsNotRetried(t *testing.T) {
+	op := &fakeOperator{startErr: fmt.Errorf("%w: too many requests", ErrRateLimited)}
+	cc := startConnector(t, op, time.Second)
+
+	for range 2 {
+		if _, err := cc.GetConnection(context.Background()); !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("GetConnection() error = %v, want %v", err, ErrRateLimited)
+		}
+	}
+	if starts := op.startCount(); starts != 1 {
+		t.Errorf("server started %d times, want 1", starts)
+	}
+}
+
+func TestServerAlreadyRunningIsAwaited(t *testing.T) {
+	op := &fakeOperator{startErr: fmt.Errorf("%w: already running", ErrServerAlreadyRunning)}
+	cc := startConnector(t, op, time.Second)
+
+	if _, err := cc.GetStatusConnection(context.Background()); err != nil {
+		t.Fatalf("GetStatusConnection() error = %v", err)
+	}
+	if state := cc.getState(); state != stateEmpty {
+		t.Errorf("state = %s, want %s", String(state), String(stateEmpty))
+	}
+}
+
+func TestCrashedServerBacksOff(t *testing.T) {
+	errCrash := errors.New("server did not come up")
+	op := &fakeOperator{awaitErr: errCrash}
+	cc := startConnector(t, op, time.Second)
+
+	if _, err := cc.GetConnection(context.Background()); !errors.Is(err, errCrash) {
+		t.Fatalf("GetConnection() error = %v, want %v", err, errCrash)
+	}
+	if state := cc.getState(); state != stateCrashed {
+		t.Fatalf("state = %s, want %s", String(state), String(stateCrashed))
+	}
+	if _, err := cc.GetConnection(context.Background()); !errors.Is(err, ErrServerCrashed) {
+		t.Fatalf("GetConnection() error = %v, want %v", err, ErrServerCrashed)
+	}
+	if starts := op.startCount(); starts != 1 {
+		t.Errorf("server started %d times, want 1", starts)
+	}
+}
+
+func TestScheduledShutdownHoldsRequests(t *testing.T) {
+	op := &fakeOperator{running: true}
+	cc := startConnector(t, op, time.Second)
+	testutil.Eventually(t, op.shutdownScheduled, "shutdown was not scheduled for the empty server")
+
+	op.mu.Lock()
+	events := op.events
+	op.mu.Unlock()
+
+	events <- ShutdownStarted
+	testutil.Eventually(t, func() bool { return cc.getState() == stateStopping }, "server is not stopping")
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := cc.GetConnection(context.Background())
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("GetConnection() returned while stopping: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	op.mu.Lock()
+	op.running = false
+	op.mu.Unlock()
+	events <- ShutdownCompleted
+
+	if err := <-done; err != nil {
+		t.Fatalf("GetConnection() error = %v", err)
+	}
+	if starts := op.startCount(); starts != 1 {
+		t.Errorf("server started %d times, want 1", starts)
+	}
+}
@@ -0,0 +1,28 @@
+package connector
+
+import "errors"
+
+// Errors a ServerOperator wraps to tell the connector how to react to a failed server action.
+var (
+	// ErrServerAlreadyRunning reports a start request for a server that is already running.
+	// The connector waits for the server to accept connections as if it had just been started.
+	ErrServerAlreadyRunning = errors.New("server already running")
+
+	// ErrNotPermitted reports that the control panel rejected the credentials or lacks the permission.
+	ErrNotPermitted = errors.New("not permitted")
+
+	// ErrServerNotFound reports that the control panel does not know the server.
+	ErrServerNotFound = errors.New("server not found")
+
+	// ErrStartTimeout reports that the server did not come up within the start-up timeout.
+	// The connector treats the server as crashed.
+	ErrStartTimeout = errors.New("server did not start in time")
+
+	// ErrServerCrashed reports that the server crashed while starting.
+	// The connector does not try to start the server again until the crash backoff has passed.
+	ErrServerCrashed = errors.New("server crashed")
+
+	// ErrRateLimited reports that the control panel throttles requests.
+	// The connector does not try to start the server again until a cooldown has passed.
+	ErrRateLimited = errors.New("rate limited")
+)
@@ -0,0 +1,189 @@
+package connector
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/testutil"
+)
+
+// fakeConn is a connection to the fake server that remembers whether it was closed.
+type fakeConn struct {
+	net.Conn
+	closed atomic.Bool
+}
+
+func (c *fakeConn) Close() error {
+	c.closed.Store(true)
+	return c.Conn.Close()
+}
+
+// fakeOperator is a ServerOperator whose operations can be slowed down or made to fail.
+type fakeOperator struct {
+	mu        sync.Mutex
+	running   bool
+	startErr  error
+	awaitErr  error
+	stopErr   error
+	starts    int
+	stops     int
+	scheduled bool
+	events    chan<- ShutdownEvent
+	conns     []*fakeConn
+
+	// Operations block until these are closed, if set.
+	startGate   chan struct{}
+	awaitGate   chan struct{}
+	connectGate chan struct{}
+}
+
+func (f *fakeOperator) StartMinecraftServer(ctx context.Context) error {
+	if err := wait(ctx, f.startGate); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.starts++
+	if f.startErr != nil {
+		return f.startErr
+	}
+	f.running = true
+	return nil
+}
+
+func (f *fakeOperator) StopMinecraftServer(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stops++
+	if f.stopErr != nil {
+		return f.stopErr
+	}
+	f.running = false
+	return nil
+}
+
+func (f *fakeOperator) IsServerRunning() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.running
+}
+
+func (f *fakeOperator) ConnectToServer() (net.Conn, error) {
+	if err := wait(context.Background(), f.connectGate); err != nil {
+		return nil, err
+	}
+	client, server := net.Pipe()
+	go func() {
+		// Drain the fake server end until the connection is closed.
+		buf := make([]byte, 512)
+		for {
+			if _, err := server.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	conn := &fakeConn{Conn: client}
+	f.mu.Lock()
+	f.conns = append(f.conns, conn)
+	f.mu.Unlock()
+	return conn, nil
+}
+
+func (f *fakeOperator) AwaitForServerStart(ctx context.Context) error {
+	if err := wait(ctx, f.awaitGate); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.awaitErr
+}
+
+func (f *fakeOperator) ScheduleShutdown(events chan<- ShutdownEvent, _ <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scheduled = true
+	f.events = events
+}
+
+func (f *fakeOperator) StopShuttingDown() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scheduled = false
+}
+
+func (f *fakeOperator) ShutdownDeadline() (time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return time.Time{}, f.scheduled
+}
+
+func (f *fakeOperator) ExtendShutdown(time.Duration) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.scheduled
+}
+
+func (f *fakeOperator) shutdownScheduled() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.scheduled
+}
+
+func (f *fakeOperator) startCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.starts
+}
+
+func (f *fakeOperator) stopCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stops
+}
+
+func (f *fakeOperator) dialed() []*fakeConn {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*fakeConn(nil), f.conns...)
+}
+
+// wait blocks until gate is closed. A nil gate does not block.
+func wait(ctx context.Context, gate chan struct{}) error {
+	if gate == nil {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-gate:
+		return nil
+	}
+}
+
+// startConnector starts a connector for op that is stopped when the test ends.
+func startConnector(t *testing.T, op *fakeOperator, dialTimeout time.Duration) *Connector {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	cc := New(testutil.Logger{T: t}, true, ShutdownOnEmpty, op, dialTimeout)
+	cc.StartLoop(ctx)
+	return cc
+}
+
+// waiterCount returns the number of requests waiting for the server, read on the loop goroutine.
+func waiterCount(t *testing.T, cc *Connector) int {
+	t.Helper()
+	var n int
+	if err := cc.execute(context.Background(), func(context.Context) error {
+		n = len(cc.waiters)
+		return nil
+	}); err != nil {
+		t.Fatalf("reading the waiters failed: %v", err)
+	}
+	return n
+}
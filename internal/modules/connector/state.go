@@ -20,6 +20,14 @@ const (
 
 	// stateEmpty indicates the server is running but has no active players.
 	stateEmpty
+
+	// stateStopping indicates the server is being stopped. Connections wait for the stop to complete
+	// and then start the server again.
+	stateStopping
+
+	// stateCrashed indicates the server crashed or did not come up while starting.
+	// It is started again once the crash backoff has passed.
+	stateCrashed
 )
 
 // String returns the human-readable name of a given state.
@@ -33,7 +41,31 @@ func String(state state) string {
 		return "Running"
 	case stateEmpty:
 		return "Empty"
+	case stateStopping:
+		return "Stopping"
+	case stateCrashed:
+		return "Crashed"
 	default:
 		return "unknown"
 	}
 }
+
+// States returns the human-readable names of all states.
+func States() []string {
+	return []string{
+		String(stateOff), String(stateStartingUp), String(stateRunning),
+		String(stateEmpty), String(stateStopping), String(stateCrashed),
+	}
+}
+
+// ShutdownMode selects what makes the connector consider the server idle.
+type ShutdownMode int
+
+const (
+	// ShutdownOnEmpty schedules a shutdown when the last player who joined through the proxy leaves.
+	ShutdownOnEmpty ShutdownMode = iota
+
+	// ShutdownOnIdle leaves shutdowns to an external watcher polling the in-game player count.
+	// The connector only schedules a shutdown when the watcher reports the server idle with ReportIdle.
+	ShutdownOnIdle
+)
@@ -0,0 +1,171 @@
+package mc_operator
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/config"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/adapters/crafty"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/testutil"
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/minecraft"
+)
+
+// fakeCrafty is a Crafty client reporting fixed server stats and counting the stops.
+type fakeCrafty struct {
+	mu       sync.Mutex
+	stats    crafty.ServerStats
+	statsErr error
+	stops    int
+}
+
+func (f *fakeCrafty) ResolveServer(context.Context, config.CraftyServer, int) (string, error) {
+	return "server-1", nil
+}
+
+func (f *fakeCrafty) StartMcServer(context.Context, string) error {
+	return nil
+}
+
+func (f *fakeCrafty) StopMcServer(context.Context, string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stops++
+	return nil
+}
+
+func (f *fakeCrafty) ServerStats(context.Context, string) (crafty.ServerStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stats, f.statsErr
+}
+
+func (f *fakeCrafty) stopCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stops
+}
+
+// newTestOperator returns an operator for the server at host that probes it every few milliseconds.
+func newTestOperator(t *testing.T, host config.Host, rcon config.RCON, craftyClient Crafty) *ServerOperator {
+	t.Helper()
+	so := New(config.ServerType{Protocol: "tcp", CraftyHost: host, RCON: rcon}, time.Second, time.Minute, testutil.Logger{T: t}, craftyClient)
+	so.probeInterval = 10 * time.Millisecond
+	return so
+}
+
+// listen opens a local TCP listener that is closed when the test ends.
+func listen(t *testing.T) (net.Listener, config.Host) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return listener, config.Host{Addr: "127.0.0.1", Port: listener.Addr().(*net.TCPAddr).Port}
+}
+
+// closedHost returns the address of a port nothing listens on.
+func closedHost(t *testing.T) config.Host {
+	t.Helper()
+	listener, host := listen(t)
+	listener.Close()
+	return host
+}
+
+// serveStatus runs a fake Minecraft server answering status pings with the number of players in players.
+func serveStatus(t *testing.T, players *atomic.Int32) config.Host {
+	t.Helper()
+	listener, host := listen(t)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				// The handshake is followed by the status request.
+				for range 2 {
+					if _, err := minecraft.ReadPacket(reader); err != nil {
+						return
+					}
+				}
+				response, err := minecraft.NewStatusResponse(minecraft.Status{
+					Version:     minecraft.StatusVersion{Name: "1.21", Protocol: 767},
+					Players:     minecraft.StatusPlayers{Max: 20, Online: int(players.Load())},
+					Description: minecraft.TextComponent("test"),
+				})
+				if err == nil {
+					_ = minecraft.WritePacket(conn, response)
+				}
+			}()
+		}
+	}()
+	return host
+}
+
+// serveRCON runs a fake RCON server accepting a single connection. It accepts any password
+// and sends the body of every command to the returned channel.
+func serveRCON(t *testing.T) (config.Host, <-chan string) {
+	t.Helper()
+	listener, host := listen(t)
+	commands := make(chan string, 16)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			id, kind, body, err := readRCON(conn)
+			if err != nil {
+				return
+			}
+			// Authentication requests (type 3) are answered with type 2, commands with type 0.
+			reply := int32(0)
+			if kind == 3 {
+				reply = 2
+			} else {
+				commands <- body
+			}
+			if err := writeRCON(conn, id, reply); err != nil {
+				return
+			}
+		}
+	}()
+	return host, commands
+}
+
+// readRCON reads a single RCON packet.
+func readRCON(r io.Reader) (id, kind int32, body string, err error) {
+	var length int32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return 0, 0, "", err
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, 0, "", err
+	}
+	id = int32(binary.LittleEndian.Uint32(data[0:4]))   //nolint:gosec
+	kind = int32(binary.LittleEndian.Uint32(data[4:8])) //nolint:gosec
+	return id, kind, string(data[8 : length-2]), nil
+}
+
+// writeRCON writes an RCON packet with an empty body.
+func writeRCON(w io.Writer, id, kind int32) error {
+	data := binary.LittleEndian.AppendUint32(nil, 10)
+	data = binary.LittleEndian.AppendUint32(data, uint32(id))   //nolint:gosec
+	data = binary.LittleEndian.AppendUint32(data, uint32(kind)) //nolint:gosec
+	_, err := w.Write(append(data, 0, 0))
+	return err
+}
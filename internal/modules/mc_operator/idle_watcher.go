@@ -0,0 +1,60 @@
+package mc_operator
+
+import (
+	"context"
+	"time"
+)
+
+// IdleTarget is the server an IdleWatcher reports idle periods to.
+type IdleTarget interface {
+	ServerUp() bool
+	AutoShutdown() bool
+	ReportIdle(ctx context.Context, idle bool) error
+}
+
+// IdleWatcher reports a server idle while its in-game player count reads zero, regardless of the connections
+// open through the proxy, so the target schedules its shutdown. Players who bypass the proxy are counted,
+// and connections that never made it into the game are not.
+type IdleWatcher struct {
+	operator *ServerOperator
+	target   IdleTarget
+	interval time.Duration
+	logger   Logger
+}
+
+// NewIdleWatcher creates an IdleWatcher polling the player count of operator's server every interval.
+func NewIdleWatcher(operator *ServerOperator, target IdleTarget, interval time.Duration, logger Logger) *IdleWatcher {
+	return &IdleWatcher{
+		operator: operator,
+		target:   target,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run polls the player count until ctx is cancelled.
+func (iw *IdleWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(iw.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !iw.target.AutoShutdown() || !iw.target.ServerUp() {
+			continue
+		}
+
+		players, err := iw.operator.OnlinePlayers(ctx)
+		if err != nil {
+			iw.logger.Debug("Failed to count players on MC server %s: %v", iw.operator.targetAddress, err)
+			continue
+		}
+		if err := iw.target.ReportIdle(ctx, players == 0); err != nil {
+			iw.logger.Debug("Failed to report players on MC server %s: %v", iw.operator.targetAddress, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package mc_operator
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/config"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/testutil"
+)
+
+// fakeIdleTarget sends the idle reports of an IdleWatcher to reports.
+type fakeIdleTarget struct {
+	up           atomic.Bool
+	autoshutdown atomic.Bool
+	reports      chan bool
+}
+
+func (f *fakeIdleTarget) ServerUp() bool {
+	return f.up.Load()
+}
+
+func (f *fakeIdleTarget) AutoShutdown() bool {
+	return f.autoshutdown.Load()
+}
+
+func (f *fakeIdleTarget) ReportIdle(ctx context.Context, idle bool) error {
+	select {
+	case f.reports <- idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// awaitReport fails the test if the watcher does not report idle as want within a second.
+func awaitReport(t *testing.T, reports <-chan bool, want bool) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case idle := <-reports:
+			if idle == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("idle watcher did not report idle = %v", want)
+		}
+	}
+}
+
+func TestIdleWatcher(t *testing.T) {
+	var players atomic.Int32
+	players.Store(2)
+	so := newTestOperator(t, serveStatus(t, &players), config.RCON{}, &fakeCrafty{})
+	target := &fakeIdleTarget{reports: make(chan bool)}
+	target.up.Store(true)
+	target.autoshutdown.Store(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		NewIdleWatcher(so, target, 10*time.Millisecond, testutil.Logger{T: t}).Run(ctx)
+	}()
+	// The watcher must not log once the test is over.
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+
+	awaitReport(t, target.reports, false)
+	players.Store(0)
+	awaitReport(t, target.reports, true)
+	players.Store(1)
+	awaitReport(t, target.reports, false)
+
+	// Nothing is reported while auto shutdown is disabled.
+	target.autoshutdown.Store(false)
+	select {
+	case <-target.reports: // Under way before auto shutdown was disabled
+	case <-time.After(50 * time.Millisecond):
+	}
+	select {
+	case idle := <-target.reports:
+		t.Errorf("idle watcher reported idle = %v with auto shutdown disabled", idle)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
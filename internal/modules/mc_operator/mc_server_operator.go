@@ -2,20 +2,43 @@
 package mc_operator
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
+	"math/rand/v2"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sund3RRR/crafty-reverse-proxy/config"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/adapters/crafty"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/metrics"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/modules/connector"
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/minecraft"
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/proxyproto"
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/raknet"
 )
 
-const dialTimeout = 1 * time.Second
+const (
+	dialTimeout = 1 * time.Second
+	// udpBufferSize is the size of the buffer used to read RakNet pongs.
+	udpBufferSize = 1500
+	// protocolUDP is the protocol of Bedrock Edition servers.
+	protocolUDP = "udp"
+	// anyProtocolVersion is sent in status pings; servers answer it regardless of their own version.
+	anyProtocolVersion = -1
+	// probeInterval is the time between the probes of a starting server.
+	probeInterval = 1 * time.Second
+)
 
 var (
 	// ErrTimeoutReached is returned when the server fails to start within the given timeout.
 	ErrTimeoutReached = errors.New("timeout reached")
+
+	// ErrServerNotRunning is returned when the player count is requested for a server that is not running.
+	ErrServerNotRunning = errors.New("server not running")
 )
 
 // Logger defines the logging interface used by ServerOperator.
@@ -28,31 +51,51 @@ type Logger interface {
 
 // Crafty defines the interface for controlling Minecraft servers via the Crafty API.
 type Crafty interface {
-	StartMcServer(port int) error
-	StopMcServer(port int) error
+	ResolveServer(ctx context.Context, server config.CraftyServer, port int) (string, error)
+	StartMcServer(ctx context.Context, serverID string) error
+	StopMcServer(ctx context.Context, serverID string) error
+	ServerStats(ctx context.Context, serverID string) (crafty.ServerStats, error)
 }
 
 // ServerOperator manages the lifecycle of a Minecraft server instance.
 type ServerOperator struct {
 	targetPort      int
+	craftyServer    config.CraftyServer
 	targetAddress   string
+	targetHost      config.Host
 	protocol        string
+	proxyProtocol   proxyproto.Version
+	readyAfter      time.Duration
+	rcon            config.RCON
 	startUpTimeout  time.Duration
 	shutDownTimeout time.Duration
+	probeInterval   time.Duration
 
 	logger        Logger
 	crafty        Crafty
+	mu            sync.Mutex
 	shutDownTimer *time.Timer
+	shutDownAt    time.Time
+	// cancelCountdown interrupts the RCON countdown of a shutdown that is already in progress.
+	cancelCountdown context.CancelFunc
+	// noCountdown is set once stops must no longer wait for the RCON countdown.
+	noCountdown atomic.Bool
 }
 
 // New creates and returns a new ServerOperator instance based on the provided configuration.
 func New(cfg config.ServerType, startUpTimeout, shutDownTimeout time.Duration, logger Logger, crafty Crafty) *ServerOperator {
 	return &ServerOperator{
 		targetPort:      cfg.CraftyHost.Port,
+		craftyServer:    cfg.CraftyServer,
 		targetAddress:   fmt.Sprintf("%s:%d", cfg.CraftyHost.Addr, cfg.CraftyHost.Port),
+		targetHost:      cfg.CraftyHost,
 		protocol:        cfg.Protocol,
+		proxyProtocol:   cfg.ProxyProtocol,
+		readyAfter:      cfg.ReadyAfter,
+		rcon:            cfg.RCON,
 		startUpTimeout:  startUpTimeout,
 		shutDownTimeout: shutDownTimeout,
+		probeInterval:   probeInterval,
 		logger:          logger,
 		crafty:          crafty,
 		shutDownTimer:   nil,
@@ -60,19 +103,161 @@ func New(cfg config.ServerType, startUpTimeout, shutDownTimeout time.Duration, l
 }
 
 // StartMinecraftServer starts the Minecraft server if it's not already running.
-func (so *ServerOperator) StartMinecraftServer() error {
+func (so *ServerOperator) StartMinecraftServer(ctx context.Context) error {
 	so.logger.Info("MC server is not running. Starting server with port %d", so.targetPort)
-	return so.crafty.StartMcServer(so.targetPort)
+	serverID, err := so.crafty.ResolveServer(ctx, so.craftyServer, so.targetPort)
+	if err == nil {
+		err = so.crafty.StartMcServer(ctx, serverID)
+	}
+	metrics.ServerActions.Inc(so.targetAddress, metrics.ActionStart, metrics.Result(err))
+	return classify(err)
+}
+
+// StopMinecraftServer warns the players online with the RCON countdown, saves the world
+// and stops the Minecraft server.
+func (so *ServerOperator) StopMinecraftServer(ctx context.Context) error {
+	so.logger.Info("Stopping MC server with port %d", so.targetPort)
+	if err := so.preStop(ctx, time.Now().Add(so.countdownLength()), false); err != nil {
+		return err
+	}
+	return so.stopServer(ctx)
+}
+
+// stopServer asks Crafty to stop the server and records the outcome.
+func (so *ServerOperator) stopServer(ctx context.Context) error {
+	serverID, err := so.crafty.ResolveServer(ctx, so.craftyServer, so.targetPort)
+	if err == nil {
+		err = so.crafty.StopMcServer(ctx, serverID)
+	}
+	metrics.ServerActions.Inc(so.targetAddress, metrics.ActionStop, metrics.Result(err))
+	return classify(err)
+}
+
+// classify wraps Crafty API errors with the connector error telling the connector how to react.
+func classify(err error) error {
+	var reaction error
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, crafty.ErrServerAlreadyRunning):
+		reaction = connector.ErrServerAlreadyRunning
+	case errors.Is(err, crafty.ErrUnauthorized), errors.Is(err, crafty.ErrForbidden):
+		reaction = connector.ErrNotPermitted
+	case errors.Is(err, crafty.ErrNotFound), errors.Is(err, crafty.ErrNoSuchServer):
+		reaction = connector.ErrServerNotFound
+	case errors.Is(err, crafty.ErrRateLimited):
+		reaction = connector.ErrRateLimited
+	default:
+		return err
+	}
+	return fmt.Errorf("%w: %w", reaction, err)
 }
 
-// IsServerRunning checks whether the Minecraft server is currently accepting connections.
+// ServerStats returns the live state of the Minecraft server reported by Crafty.
+func (so *ServerOperator) ServerStats(ctx context.Context) (crafty.ServerStats, error) {
+	serverID, err := so.crafty.ResolveServer(ctx, so.craftyServer, so.targetPort)
+	if err != nil {
+		return crafty.ServerStats{}, err
+	}
+	return so.crafty.ServerStats(ctx, serverID)
+}
+
+// IsServerRunning checks whether the Minecraft server is currently answering status pings.
 func (so *ServerOperator) IsServerRunning() bool {
+	return so.probe() == nil
+}
+
+// OnlinePlayers returns the number of players in game. It asks the server itself with a status ping
+// and falls back to the stats reported by Crafty if the server does not answer.
+func (so *ServerOperator) OnlinePlayers(ctx context.Context) (int, error) {
+	players, err := so.ping()
+	if err == nil {
+		return players, nil
+	}
+
+	stats, statsErr := so.ServerStats(ctx)
+	if statsErr != nil {
+		return 0, fmt.Errorf("status ping: %w, crafty stats: %w", err, statsErr)
+	}
+	if !stats.Running {
+		return 0, ErrServerNotRunning
+	}
+	return stats.Online, nil
+}
+
+// probe checks once whether the server is ready for players.
+func (so *ServerOperator) probe() error {
+	_, err := so.ping()
+	return err
+}
+
+// ping asks the server for its status and returns the number of players online.
+// Java servers open their port before the world is loaded, so they are asked for their status instead of
+// just dialed. UDP is connectionless, so Bedrock servers are pinged with a RakNet unconnected ping.
+func (so *ServerOperator) ping() (int, error) {
 	serverConnection, err := net.DialTimeout(so.protocol, so.targetAddress, dialTimeout)
 	if err != nil {
-		return false
+		return 0, err
 	}
-	serverConnection.Close()
-	return true
+	defer serverConnection.Close()
+
+	_ = serverConnection.SetDeadline(time.Now().Add(dialTimeout))
+	if so.protocol == protocolUDP {
+		return pingBedrock(serverConnection)
+	}
+	return so.pingJava(serverConnection)
+}
+
+// pingJava performs a Server List Ping and checks that a valid status comes back.
+func (so *ServerOperator) pingJava(serverConnection net.Conn) (int, error) {
+	if so.proxyProtocol != "" {
+		if err := proxyproto.WriteHeader(serverConnection, so.proxyProtocol, serverConnection.LocalAddr(), serverConnection.RemoteAddr()); err != nil {
+			return 0, err
+		}
+	}
+
+	handshake := minecraft.Handshake{
+		ProtocolVersion: anyProtocolVersion,
+		ServerAddress:   so.targetHost.Addr,
+		ServerPort:      uint16(so.targetHost.Port), //nolint:gosec
+		NextState:       minecraft.NextStateStatus,
+	}
+	if _, err := serverConnection.Write(append(handshake.Marshal().Marshal(), minecraft.NewStatusRequest().Marshal()...)); err != nil {
+		return 0, err
+	}
+
+	response, err := minecraft.ReadPacket(bufio.NewReader(serverConnection))
+	if err != nil {
+		return 0, err
+	}
+	status, err := minecraft.ParseStatusResponse(response)
+	if err != nil {
+		return 0, err
+	}
+	return status.Players.Online, nil
+}
+
+// pingBedrock sends a RakNet unconnected ping and checks that a valid pong comes back.
+func pingBedrock(serverConnection net.Conn) (int, error) {
+	ping := raknet.UnconnectedPing{Time: time.Now().UnixMilli(), ClientGUID: rand.Int64()} //nolint:gosec
+	if _, err := serverConnection.Write(ping.Marshal()); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, udpBufferSize)
+	n, err := serverConnection.Read(buf)
+	if err != nil {
+		return 0, err
+	}
+	pong, err := raknet.ParsePong(buf[:n])
+	if err != nil {
+		return 0, err
+	}
+	status, err := raknet.ParseServerID(pong.ServerID)
+	if err != nil {
+		return 0, err
+	}
+	return status.Online, nil
 }
 
 // ConnectToServer attempts to establish a network connection to the server.
@@ -80,54 +265,174 @@ func (so *ServerOperator) ConnectToServer() (net.Conn, error) {
 	return net.DialTimeout(so.protocol, so.targetAddress, dialTimeout)
 }
 
-// AwaitForServerStart waits for the server to start up and accept connections within a timeout.
+// AwaitForServerStart waits for the server to start up and answer status pings within a timeout.
+// If a ready delay is configured, the server must keep answering for that long before it is considered ready.
 func (so *ServerOperator) AwaitForServerStart(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, so.startUpTimeout)
 	defer cancel()
 
-	const cooldown = time.Second
-	ticker := time.NewTicker(cooldown)
+	// crashCheckEvery is the number of failed attempts after which Crafty is asked whether the server crashed.
+	const crashCheckEvery = 5
+	ticker := time.NewTicker(so.probeInterval)
 	defer ticker.Stop()
 
 	attempt := 1
+	started := time.Now()
+	var answering time.Time // Start of the current streak of successful probes
 	so.logger.Info("Waiting for server :%d to start...", so.targetPort)
 
 	for {
 		select {
 		case <-ctx.Done():
-			return ErrTimeoutReached
+			metrics.ColdStartDuration.Observe(time.Since(started).Seconds(), so.targetAddress, metrics.ResultFailure)
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return ctx.Err()
+			}
+			return fmt.Errorf("%w: %w after %s", connector.ErrStartTimeout, ErrTimeoutReached, so.startUpTimeout)
 		case <-ticker.C:
 			so.logger.Debug("Attempt %d: connecting to %s (%s)", attempt, so.targetAddress, so.protocol)
-			conn, err := net.DialTimeout(so.protocol, so.targetAddress, dialTimeout)
-			if err != nil {
+			if err := so.probe(); err != nil {
 				so.logger.Warn("Connection attempt %d failed: %v", attempt, err)
+				if attempt%crashCheckEvery == 0 {
+					if stats, statsErr := so.ServerStats(ctx); statsErr == nil && stats.Crashed {
+						metrics.ColdStartDuration.Observe(time.Since(started).Seconds(), so.targetAddress, metrics.ResultFailure)
+						return fmt.Errorf("%w: reported by Crafty after %d attempts", connector.ErrServerCrashed, attempt)
+					}
+				}
+				answering = time.Time{}
+				attempt++
+				continue
+			}
+			if answering.IsZero() {
+				answering = time.Now()
+			}
+			if time.Since(answering) < so.readyAfter {
+				so.logger.Debug("Server %s answers, waiting %s before declaring it ready", so.targetAddress, so.readyAfter)
 				attempt++
 				continue
 			}
-			conn.Close()
 			so.logger.Info("Server %s is up! Connected on attempt %d", so.targetAddress, attempt)
+			metrics.ColdStartDuration.Observe(time.Since(started).Seconds(), so.targetAddress, metrics.ResultSuccess)
 			return nil
 		}
 	}
 }
 
 // ScheduleShutdown sets a timer to shut down the server after a period of inactivity.
-func (so *ServerOperator) ScheduleShutdown(shutdownEmitter chan<- struct{}) {
+// The RCON countdown runs within the timeout, so the server is stopped when the timeout is over.
+// The progress of the shutdown is reported on events until done is closed.
+func (so *ServerOperator) ScheduleShutdown(events chan<- connector.ShutdownEvent, done <-chan struct{}) {
 	so.logger.Info("No players left, scheduling MC server shutdown with port %d and timeout %s", so.targetPort, so.shutDownTimeout.String())
-	so.shutDownTimer = time.AfterFunc(so.shutDownTimeout, func() {
+
+	so.mu.Lock()
+	defer so.mu.Unlock()
+
+	so.stopTimers()
+
+	var timer *time.Timer
+	timer = time.AfterFunc(so.countdownDelay(so.shutDownTimeout), func() {
+		// The timer outlives any caller, the Crafty client's request timeout bounds the stop.
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		so.mu.Lock()
+		if so.shutDownTimer != timer {
+			so.mu.Unlock()
+			return
+		}
+		so.shutDownTimer = nil
+		so.cancelCountdown = cancel
+		stopAt := so.shutDownAt
+		so.mu.Unlock()
+
 		so.logger.Info("No players left, shutting down MC server with port %d", so.targetPort)
-		if err := so.crafty.StopMcServer(so.targetPort); err != nil {
+		err := so.preStop(ctx, stopAt, true)
+
+		// Past the countdown, joining players no longer interrupt the stop.
+		so.mu.Lock()
+		if err == nil {
+			err = ctx.Err()
+		}
+		so.cancelCountdown = nil
+		so.mu.Unlock()
+		if err != nil {
+			so.logger.Info("Shutdown of MC server with port %d cancelled: %v", so.targetPort, err)
+			return
+		}
+
+		if !sendEvent(events, done, connector.ShutdownStarted) {
+			return
+		}
+		if err := so.stopServer(ctx); err != nil {
 			so.logger.Error("Failed to stop MC server: %v", err)
+			sendEvent(events, done, connector.ShutdownFailed)
 			return
 		}
-		shutdownEmitter <- struct{}{}
+		sendEvent(events, done, connector.ShutdownCompleted)
 	})
+	so.shutDownTimer = timer
+	so.shutDownAt = time.Now().Add(so.shutDownTimeout)
+}
+
+// sendEvent reports a shutdown event, unless done is closed first. It returns false if the event was not sent.
+func sendEvent(events chan<- connector.ShutdownEvent, done <-chan struct{}, event connector.ShutdownEvent) bool {
+	select {
+	case events <- event:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// countdownDelay returns the time from now until the countdown of a shutdown due in timeout has to begin.
+func (so *ServerOperator) countdownDelay(timeout time.Duration) time.Duration {
+	return max(timeout-so.countdownLength(), 0)
 }
 
 // StopShuttingDown cancels a scheduled shutdown if the server becomes active again.
+// A shutdown whose countdown is running is cancelled as well.
 func (so *ServerOperator) StopShuttingDown() {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+
+	so.stopTimers()
+}
+
+// stopTimers stops the shutdown timer and the countdown. The caller must hold mu.
+func (so *ServerOperator) stopTimers() {
 	if so.shutDownTimer != nil {
 		so.shutDownTimer.Stop()
 		so.shutDownTimer = nil
 	}
+	if so.cancelCountdown != nil {
+		so.cancelCountdown()
+		so.cancelCountdown = nil
+	}
+}
+
+// ShutdownDeadline returns the time of the scheduled shutdown, if there is one.
+// A shutdown whose countdown is running is still scheduled.
+func (so *ServerOperator) ShutdownDeadline() (time.Time, bool) {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+
+	if so.shutDownTimer == nil && so.cancelCountdown == nil {
+		return time.Time{}, false
+	}
+	return so.shutDownAt, true
+}
+
+// ExtendShutdown postpones the scheduled shutdown by extra.
+// It returns false if no shutdown is scheduled or its countdown has already begun.
+func (so *ServerOperator) ExtendShutdown(extra time.Duration) bool {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+
+	if so.shutDownTimer == nil || !so.shutDownTimer.Stop() {
+		return false
+	}
+	so.shutDownAt = so.shutDownAt.Add(extra)
+	so.shutDownTimer.Reset(so.countdownDelay(time.Until(so.shutDownAt)))
+	so.logger.Info("MC server shutdown with port %d postponed until %s", so.targetPort, so.shutDownAt.Format(time.DateTime))
+	return true
 }
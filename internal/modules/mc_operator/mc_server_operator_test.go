@@ -0,0 +1,131 @@
+package mc_operator
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/config"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/adapters/crafty"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/modules/connector"
+)
+
+func TestAwaitForServerStart(t *testing.T) {
+	var players atomic.Int32
+	tests := []struct {
+		name     string
+		host     config.Host
+		stats    crafty.ServerStats
+		wantErrs []error
+	}{
+		{name: "ready", host: serveStatus(t, &players)},
+		{
+			name:     "crashed",
+			host:     closedHost(t),
+			stats:    crafty.ServerStats{Running: false, Crashed: true},
+			wantErrs: []error{connector.ErrServerCrashed},
+		},
+		{
+			name:     "timeout",
+			host:     closedHost(t),
+			stats:    crafty.ServerStats{Running: true},
+			wantErrs: []error{connector.ErrStartTimeout, ErrTimeoutReached},
+		},
+	}
+	for _, tt := range tests {
+		so := newTestOperator(t, tt.host, config.RCON{}, &fakeCrafty{stats: tt.stats})
+		so.startUpTimeout = 300 * time.Millisecond
+
+		err := so.AwaitForServerStart(context.Background())
+		if len(tt.wantErrs) == 0 && err != nil {
+			t.Errorf("%s: AwaitForServerStart() error = %v, want nil", tt.name, err)
+		}
+		for _, want := range tt.wantErrs {
+			if !errors.Is(err, want) {
+				t.Errorf("%s: AwaitForServerStart() error = %v, want %v", tt.name, err, want)
+			}
+		}
+	}
+}
+
+func TestAwaitForServerStartWaitsReadyDelay(t *testing.T) {
+	var players atomic.Int32
+	so := newTestOperator(t, serveStatus(t, &players), config.RCON{}, &fakeCrafty{})
+	so.readyAfter = 100 * time.Millisecond
+
+	started := time.Now()
+	if err := so.AwaitForServerStart(context.Background()); err != nil {
+		t.Fatalf("AwaitForServerStart() error = %v", err)
+	}
+	if elapsed := time.Since(started); elapsed < so.readyAfter {
+		t.Errorf("AwaitForServerStart() returned after %s, want at least %s", elapsed, so.readyAfter)
+	}
+}
+
+func TestOnlinePlayers(t *testing.T) {
+	var players atomic.Int32
+	players.Store(3)
+
+	tests := []struct {
+		name    string
+		host    config.Host
+		stats   crafty.ServerStats
+		want    int
+		wantErr error
+	}{
+		{name: "status ping", host: serveStatus(t, &players), stats: crafty.ServerStats{Running: true, Online: 1}, want: 3},
+		{name: "crafty stats", host: closedHost(t), stats: crafty.ServerStats{Running: true, Online: 1}, want: 1},
+		{name: "not running", host: closedHost(t), wantErr: ErrServerNotRunning},
+	}
+	for _, tt := range tests {
+		so := newTestOperator(t, tt.host, config.RCON{}, &fakeCrafty{stats: tt.stats})
+		got, err := so.OnlinePlayers(context.Background())
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: OnlinePlayers() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("%s: OnlinePlayers() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleShutdown(t *testing.T) {
+	craftyClient := &fakeCrafty{}
+	so := newTestOperator(t, closedHost(t), config.RCON{}, craftyClient)
+	so.shutDownTimeout = 50 * time.Millisecond
+	events := make(chan connector.ShutdownEvent, 2)
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+
+	so.ScheduleShutdown(events, done)
+	if _, scheduled := so.ShutdownDeadline(); !scheduled {
+		t.Fatal("ShutdownDeadline() reports no scheduled shutdown")
+	}
+	for _, want := range []connector.ShutdownEvent{connector.ShutdownStarted, connector.ShutdownCompleted} {
+		select {
+		case event := <-events:
+			if event != want {
+				t.Fatalf("shutdown event = %v, want %v", event, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("shutdown event %v was not sent", want)
+		}
+	}
+	if stops := craftyClient.stopCount(); stops != 1 {
+		t.Errorf("server stopped %d times, want 1", stops)
+	}
+
+	so.ScheduleShutdown(events, done)
+	if !so.ExtendShutdown(time.Minute) {
+		t.Error("ExtendShutdown() = false for a scheduled shutdown")
+	}
+	so.StopShuttingDown()
+	if _, scheduled := so.ShutdownDeadline(); scheduled {
+		t.Error("ShutdownDeadline() reports a cancelled shutdown")
+	}
+	if so.ExtendShutdown(time.Minute) {
+		t.Error("ExtendShutdown() = true without a scheduled shutdown")
+	}
+}
@@ -0,0 +1,119 @@
+package mc_operator
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/rcon"
+)
+
+const (
+	// rconTimeout is the timeout of connecting to RCON and of every RCON command.
+	rconTimeout = 5 * time.Second
+	// defaultWarningMessage is broadcast during the countdown if no warning message is configured.
+	defaultWarningMessage = "Server shutting down in %s"
+	// saveCommand flushes the world to disk before the server is stopped.
+	saveCommand = "save-all"
+)
+
+// preStop prepares the server for a stop over RCON: it warns the players online with the countdown
+// ending at stopAt, runs the pre-stop commands and saves the world. A scheduled stop always waits until
+// stopAt, a forced one only while players are being warned. RCON being unreachable does not prevent
+// the stop, but a cancelled ctx before the stop is due does, and is returned as the error.
+func (so *ServerOperator) preStop(ctx context.Context, stopAt time.Time, scheduled bool) error {
+	due := func() error {
+		if !scheduled {
+			return nil
+		}
+		return sleep(ctx, time.Until(stopAt))
+	}
+	if !so.rcon.Enabled {
+		return due()
+	}
+
+	client, err := rcon.Dial(so.rcon.Host.String(), so.rcon.Password, rconTimeout)
+	if err != nil {
+		so.logger.Warn("RCON of MC server %s is unreachable, stopping without warning: %v", so.targetAddress, err)
+		return due()
+	}
+	defer client.Close()
+
+	if err := so.countdown(ctx, client, stopAt); err != nil {
+		return err
+	}
+	if err := due(); err != nil {
+		return err
+	}
+
+	for _, command := range append(slices.Clone(so.rcon.PreStopCommands), saveCommand) {
+		if _, err := client.Command(command); err != nil {
+			so.logger.Warn("RCON command %q on MC server %s failed: %v", command, so.targetAddress, err)
+			return nil
+		}
+	}
+	return nil
+}
+
+// SkipCountdown makes later stops skip the RCON countdown, so they do not hold up the exit of the process.
+// The pre-stop commands and the save still run.
+func (so *ServerOperator) SkipCountdown() {
+	so.noCountdown.Store(true)
+}
+
+// countdownLength returns the time from the first warning of the countdown until the stop.
+func (so *ServerOperator) countdownLength() time.Duration {
+	if !so.rcon.Enabled || len(so.rcon.Countdown) == 0 || so.noCountdown.Load() {
+		return 0
+	}
+	return slices.Max(so.rcon.Countdown)
+}
+
+// countdown warns the players at every configured time before stopAt and waits until the stop is due.
+// A warning whose time has passed is still sent until the next one is due, as the countdown only begins
+// once RCON is connected. Without players online, nobody is warned and the stop is not delayed.
+func (so *ServerOperator) countdown(ctx context.Context, client *rcon.Client, stopAt time.Time) error {
+	warnings := slices.Sorted(slices.Values(so.rcon.Countdown))
+	slices.Reverse(warnings)
+	if len(warnings) == 0 || so.noCountdown.Load() {
+		return nil
+	}
+	if players, err := so.ping(); err == nil && players == 0 {
+		so.logger.Debug("No players on MC server %s, stopping without countdown", so.targetAddress)
+		return nil
+	}
+
+	message := so.rcon.WarningMessage
+	if message == "" {
+		message = defaultWarningMessage
+	}
+
+	for i, remaining := range warnings {
+		if left := time.Until(stopAt); left <= 0 || (i+1 < len(warnings) && left <= warnings[i+1]) {
+			continue
+		}
+		if err := sleep(ctx, time.Until(stopAt.Add(-remaining))); err != nil {
+			return err
+		}
+		text := strings.ReplaceAll(message, "%s", remaining.String())
+		if _, err := client.Command("say " + text); err != nil {
+			so.logger.Warn("Failed to warn players on MC server %s: %v", so.targetAddress, err)
+		}
+	}
+	return sleep(ctx, time.Until(stopAt))
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("countdown interrupted: %w", ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,80 @@
+package mc_operator
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/config"
+)
+
+// preStopCommand is the pre-stop command of the tests.
+const preStopCommand = "whitelist on"
+
+func TestStopMinecraftServerCountdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		players int32
+		skip    bool
+		want    []string
+	}{
+		{
+			name:    "players online",
+			players: 1,
+			want: []string{
+				"say Server shutting down in 300ms",
+				"say Server shutting down in 200ms",
+				"say Server shutting down in 100ms",
+				preStopCommand,
+				saveCommand,
+			},
+		},
+		{name: "no players online", players: 0, want: []string{preStopCommand, saveCommand}},
+		{name: "countdown skipped", players: 1, skip: true, want: []string{preStopCommand, saveCommand}},
+	}
+	for _, tt := range tests {
+		var players atomic.Int32
+		players.Store(tt.players)
+		rconHost, commands := serveRCON(t)
+		craftyClient := &fakeCrafty{}
+		so := newTestOperator(t, serveStatus(t, &players), config.RCON{
+			Enabled:         true,
+			Host:            rconHost,
+			Password:        "secret",
+			Countdown:       []time.Duration{100 * time.Millisecond, 300 * time.Millisecond, 200 * time.Millisecond},
+			PreStopCommands: []string{preStopCommand},
+		}, craftyClient)
+		if tt.skip {
+			so.SkipCountdown()
+		}
+
+		if err := so.StopMinecraftServer(context.Background()); err != nil {
+			t.Fatalf("%s: StopMinecraftServer() error = %v", tt.name, err)
+		}
+		if stops := craftyClient.stopCount(); stops != 1 {
+			t.Errorf("%s: server stopped %d times, want 1", tt.name, stops)
+		}
+
+		var got []string
+		for len(commands) > 0 {
+			got = append(got, <-commands)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: RCON commands = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStopMinecraftServerWithoutRCON(t *testing.T) {
+	craftyClient := &fakeCrafty{}
+	so := newTestOperator(t, closedHost(t), config.RCON{Enabled: true, Host: closedHost(t), Countdown: []time.Duration{time.Minute}}, craftyClient)
+
+	if err := so.StopMinecraftServer(context.Background()); err != nil {
+		t.Fatalf("StopMinecraftServer() error = %v", err)
+	}
+	if stops := craftyClient.stopCount(); stops != 1 {
+		t.Errorf("server stopped %d times, want 1", stops)
+	}
+}
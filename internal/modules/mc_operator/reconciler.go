@@ -0,0 +1,62 @@
+package mc_operator
+
+import (
+	"context"
+	"time"
+)
+
+// Observer receives the state of the Minecraft server as reported by Crafty.
+type Observer interface {
+	Observe(ctx context.Context, running bool, players int) error
+}
+
+// Reconciler periodically reports the server stats from Crafty to an Observer,
+// so servers started, stopped or joined outside the proxy are noticed.
+type Reconciler struct {
+	operator *ServerOperator
+	observer Observer
+	interval time.Duration
+	logger   Logger
+}
+
+// NewReconciler creates a Reconciler polling the server of operator every interval.
+func NewReconciler(operator *ServerOperator, observer Observer, interval time.Duration, logger Logger) *Reconciler {
+	return &Reconciler{
+		operator: operator,
+		observer: observer,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run polls Crafty until ctx is cancelled.
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reconcile(ctx)
+		}
+	}
+}
+
+// reconcile fetches the server stats once and reports them to the observer.
+func (r *Reconciler) reconcile(ctx context.Context) {
+	stats, err := r.operator.ServerStats(ctx)
+	if err != nil {
+		r.logger.Warn("Failed to get stats of MC server %s: %v", r.operator.targetAddress, err)
+		return
+	}
+	// Crafty stops the server while updating it; the state is settled once the update is done.
+	if stats.Updating {
+		return
+	}
+
+	if err := r.observer.Observe(ctx, stats.Running && !stats.Crashed, stats.Online); err != nil {
+		r.logger.Debug("Failed to reconcile MC server %s: %v", r.operator.targetAddress, err)
+	}
+}
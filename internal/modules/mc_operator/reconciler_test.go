@@ -0,0 +1,57 @@
+package mc_operator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/config"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/adapters/crafty"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/testutil"
+)
+
+// observation is a server state reported to an Observer.
+type observation struct {
+	running bool
+	players int
+}
+
+// fakeObserver records the reported server states.
+type fakeObserver struct {
+	observations []observation
+}
+
+func (f *fakeObserver) Observe(_ context.Context, running bool, players int) error {
+	f.observations = append(f.observations, observation{running: running, players: players})
+	return nil
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name     string
+		stats    crafty.ServerStats
+		statsErr error
+		want     []observation
+	}{
+		{name: "running", stats: crafty.ServerStats{Running: true, Online: 3}, want: []observation{{running: true, players: 3}}},
+		{name: "stopped", stats: crafty.ServerStats{}, want: []observation{{running: false, players: 0}}},
+		{name: "crashed", stats: crafty.ServerStats{Running: true, Crashed: true}, want: []observation{{running: false, players: 0}}},
+		{name: "updating", stats: crafty.ServerStats{Updating: true}},
+		{name: "stats unavailable", statsErr: errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		observer := &fakeObserver{}
+		so := newTestOperator(t, closedHost(t), config.RCON{}, &fakeCrafty{stats: tt.stats, statsErr: tt.statsErr})
+		NewReconciler(so, observer, 0, testutil.Logger{T: t}).reconcile(context.Background())
+
+		if len(observer.observations) != len(tt.want) {
+			t.Errorf("%s: observations = %+v, want %+v", tt.name, observer.observations, tt.want)
+			continue
+		}
+		for i, want := range tt.want {
+			if observer.observations[i] != want {
+				t.Errorf("%s: observations = %+v, want %+v", tt.name, observer.observations, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package proxy
+
+import (
+	"io"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/metrics"
+)
+
+// countingWriter records the bytes written through it in the proxied bytes metric.
+type countingWriter struct {
+	writer    io.Writer
+	address   string
+	direction string
+}
+
+// Write implements io.Writer.
+func (cw countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.writer.Write(p)
+	metrics.BytesProxied.Add(float64(n), cw.address, cw.direction)
+	return n, err
+}
@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/minecraft"
+)
+
+// defaultJoinThreshold is the number of bytes an encrypted login session must receive before the player
+// counts as joined, if none is configured. The play phase starts with chunk data, which is far larger than
+// anything sent while logging in.
+const defaultJoinThreshold = 32 * 1024
+
+// joinPhase is how far a joinWatcher has followed the login.
+type joinPhase int
+
+const (
+	// joinPhaseLogin follows the unencrypted login packets.
+	joinPhaseLogin joinPhase = iota
+	// joinPhaseEncrypted counts the bytes of a login that switched to encryption.
+	joinPhaseEncrypted
+	// joinPhaseDone ignores everything after the login succeeded or failed.
+	joinPhaseDone
+)
+
+// joinWatcher calls onJoin once the server has let the client past the login phase.
+// It is used on the server to client direction of login sessions.
+//
+// While the login is unencrypted (offline mode servers), the packets are followed and the player joins with
+// the Login Success packet; a login Disconnect means the player never joins. Online mode servers encrypt
+// everything after the Encryption Request, so from then on the player joins once threshold bytes have been
+// received. That is a heuristic: a failed login with a large configuration phase (1.20.2+ registry data)
+// may reach it, and a tiny world may not, so the threshold is configurable per address.
+type joinWatcher struct {
+	writer    io.Writer
+	onJoin    func()
+	threshold int
+
+	phase      joinPhase
+	compressed bool   // Whether Set Compression was received
+	pending    []byte // Received bytes not yet forming a whole packet
+	received   int    // Bytes received since encryption started
+}
+
+// newJoinWatcher creates a joinWatcher writing to writer. A threshold of zero selects defaultJoinThreshold.
+func newJoinWatcher(writer io.Writer, threshold int, onJoin func()) *joinWatcher {
+	if threshold <= 0 {
+		threshold = defaultJoinThreshold
+	}
+	return &joinWatcher{writer: writer, onJoin: onJoin, threshold: threshold}
+}
+
+// Write implements io.Writer.
+func (jw *joinWatcher) Write(p []byte) (int, error) {
+	n, err := jw.writer.Write(p)
+	jw.observe(p[:n])
+	return n, err
+}
+
+// observe follows the login through the bytes sent to the client.
+func (jw *joinWatcher) observe(p []byte) {
+	switch jw.phase {
+	case joinPhaseLogin:
+		jw.pending = append(jw.pending, p...)
+		jw.readPackets()
+	case joinPhaseEncrypted:
+		jw.count(len(p))
+	case joinPhaseDone:
+	}
+}
+
+// readPackets handles every whole packet in pending.
+func (jw *joinWatcher) readPackets() {
+	for jw.phase == joinPhaseLogin {
+		reader := bytes.NewReader(jw.pending)
+		length, err := minecraft.ReadVarInt(reader)
+		if err != nil && !errors.Is(err, io.EOF) {
+			jw.encrypted()
+			return
+		}
+		if err != nil || reader.Len() < int(length) {
+			return // Wait for the rest of the packet.
+		}
+		if length <= 0 || length > minecraft.MaxPacketLength {
+			jw.encrypted()
+			return
+		}
+
+		headerLength := len(jw.pending) - reader.Len()
+		body := jw.pending[headerLength : headerLength+int(length)]
+		jw.pending = jw.pending[headerLength+int(length):]
+
+		id, err := jw.packetID(body)
+		if err != nil {
+			jw.encrypted()
+			return
+		}
+		switch id {
+		case minecraft.LoginDisconnectPacketID:
+			jw.done()
+		case minecraft.EncryptionRequestPacketID:
+			jw.encrypted()
+		case minecraft.LoginSuccessPacketID:
+			jw.done()
+			jw.onJoin()
+		case minecraft.SetCompressionPacketID:
+			jw.compressed = true
+		}
+	}
+}
+
+// packetID returns the ID of a packet body, decompressing its start if compression is enabled.
+func (jw *joinWatcher) packetID(body []byte) (int32, error) {
+	reader := bytes.NewReader(body)
+	if !jw.compressed {
+		return minecraft.ReadVarInt(reader)
+	}
+
+	dataLength, err := minecraft.ReadVarInt(reader)
+	if err != nil {
+		return 0, err
+	}
+	if dataLength == 0 {
+		return minecraft.ReadVarInt(reader)
+	}
+	decompressed, err := zlib.NewReader(reader)
+	if err != nil {
+		return 0, err
+	}
+	defer decompressed.Close()
+	return minecraft.ReadVarInt(bufio.NewReader(decompressed))
+}
+
+// encrypted stops following packets and counts the bytes received from now on, starting with
+// those already buffered.
+func (jw *joinWatcher) encrypted() {
+	jw.phase = joinPhaseEncrypted
+	buffered := len(jw.pending)
+	jw.pending = nil
+	jw.count(buffered)
+}
+
+// count adds n received bytes and reports the join once the threshold is reached.
+func (jw *joinWatcher) count(n int) {
+	jw.received += n
+	if jw.received >= jw.threshold {
+		jw.done()
+		jw.onJoin()
+	}
+}
+
+// done stops watching the session.
+func (jw *joinWatcher) done() {
+	jw.phase = joinPhaseDone
+	jw.pending = nil
+}
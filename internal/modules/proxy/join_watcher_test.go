@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"testing"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/minecraft"
+)
+
+// compressedPacket encodes p in the compressed format used after Set Compression.
+// Packets are zlib-compressed if compress is set, and sent with a data length of 0 otherwise.
+func compressedPacket(t *testing.T, p minecraft.Packet, compress bool) []byte {
+	t.Helper()
+	data := minecraft.AppendVarInt(nil, p.ID)
+	data = append(data, p.Data...)
+	if !compress {
+		return minecraft.Packet{ID: 0, Data: data}.Marshal()
+	}
+
+	var zipped bytes.Buffer
+	writer := zlib.NewWriter(&zipped)
+	if _, err := writer.Write(data); err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+	// The body is the uncompressed length followed by the compressed data, wrapped like a packet.
+	body := append(minecraft.AppendVarInt(nil, int32(len(data))), zipped.Bytes()...) //nolint:gosec
+	return append(minecraft.AppendVarInt(nil, int32(len(body))), body...)            //nolint:gosec
+}
+
+func TestJoinWatcher(t *testing.T) {
+	setCompression := minecraft.Packet{ID: minecraft.SetCompressionPacketID, Data: minecraft.AppendVarInt(nil, 256)}.Marshal()
+	loginSuccess := minecraft.Packet{ID: minecraft.LoginSuccessPacketID, Data: make([]byte, 24)}
+	disconnect := minecraft.NewLoginDisconnect(minecraft.TextComponent("You are banned"))
+	encryptionRequest := minecraft.Packet{ID: minecraft.EncryptionRequestPacketID, Data: make([]byte, 180)}.Marshal()
+	const threshold = 1024
+
+	tests := []struct {
+		name       string
+		stream     [][]byte // Writes to the watcher
+		wantJoined bool
+	}{
+		{
+			name:       "offline login",
+			stream:     [][]byte{loginSuccess.Marshal()},
+			wantJoined: true,
+		},
+		{
+			name:       "offline login with uncompressed login success",
+			stream:     [][]byte{setCompression, compressedPacket(t, loginSuccess, false)},
+			wantJoined: true,
+		},
+		{
+			name:       "offline login with compressed login success",
+			stream:     [][]byte{setCompression, compressedPacket(t, loginSuccess, true)},
+			wantJoined: true,
+		},
+		{
+			name:   "disconnected while logging in",
+			stream: [][]byte{setCompression, compressedPacket(t, disconnect, false), make([]byte, threshold)},
+		},
+		{
+			name:   "large unencrypted login before success",
+			stream: [][]byte{minecraft.Packet{ID: 0x04, Data: make([]byte, threshold*2)}.Marshal()},
+		},
+		{
+			name:   "online login below the threshold",
+			stream: [][]byte{encryptionRequest, make([]byte, threshold-1)},
+		},
+		{
+			name:       "online login reaching the threshold",
+			stream:     [][]byte{encryptionRequest, make([]byte, threshold-1), {0}},
+			wantJoined: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			joins := 0
+			watcher := newJoinWatcher(io.Discard, threshold, func() { joins++ })
+
+			for _, data := range tt.stream {
+				// Split every write, so packets arrive in pieces like they do over TCP.
+				for len(data) > 0 {
+					n := min(len(data), 7)
+					if _, err := watcher.Write(data[:n]); err != nil {
+						t.Fatalf("Write() error = %v", err)
+					}
+					data = data[n:]
+				}
+			}
+			if !tt.wantJoined {
+				if joins != 0 {
+					t.Errorf("onJoin called %d times, want 0", joins)
+				}
+				return
+			}
+
+			// Play phase traffic never reports the player again.
+			if _, err := watcher.Write(make([]byte, threshold)); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if joins != 1 {
+				t.Errorf("onJoin called %d times, want 1", joins)
+			}
+		})
+	}
+}
+
+func TestJoinWatcherDefaultThreshold(t *testing.T) {
+	joined := false
+	watcher := newJoinWatcher(io.Discard, 0, func() { joined = true })
+
+	encryptionRequest := minecraft.Packet{ID: minecraft.EncryptionRequestPacketID, Data: make([]byte, 180)}.Marshal()
+	if _, err := watcher.Write(append(encryptionRequest, make([]byte, defaultJoinThreshold-1)...)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if joined {
+		t.Fatal("player joined below the default threshold")
+	}
+	if _, err := watcher.Write([]byte{0}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if !joined {
+		t.Error("player did not join at the default threshold")
+	}
+}
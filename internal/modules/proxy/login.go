@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"cmp"
+	"context"
+	"errors"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/modules/connector"
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/minecraft"
+)
+
+// Disconnect reasons used when none is configured.
+const (
+	defaultStartingMessage = "&eServer is starting, please retry in a moment"
+	defaultStoppingMessage = "&eServer is stopping and will start again, please retry in a moment"
+	defaultCrashedMessage  = "&cServer failed to start, please try again later"
+)
+
+// isServerAvailable reports whether the Minecraft server is up and can accept players.
+func (rt *route) isServerAvailable() bool {
+	serverState := rt.connector.ServerState()
+	return serverState == stateEmpty || serverState == stateRunning
+}
+
+// wakeUp wakes the server up in the background for the given client. A crashed server in its backoff and
+// a throttled start are expected while clients keep retrying, so they are only logged at debug level.
+func (rt *route) wakeUp(ctx context.Context, logger Logger, client string) {
+	go func() {
+		err := rt.connector.WakeUp(ctx)
+		switch {
+		case err == nil:
+		case errors.Is(err, connector.ErrServerCrashed), errors.Is(err, connector.ErrRateLimited):
+			logger.Debug("Server not woken up for %s: %v", client, err)
+		default:
+			logger.Error("Failed to wake up server for %s: %v", client, err)
+		}
+	}()
+}
+
+// kickWhileStarting wakes the server up in the background and disconnects the player
+// with the message configured for the server state.
+func (ps *Server) kickWhileStarting(ctx context.Context, client *sniffConn, rt *route) error {
+	loginStart := client.LoginStart()
+
+	rt.wakeUp(ctx, ps.logger, loginStart.Name)
+
+	serverState := rt.connector.ServerState()
+	message := rt.kickMessage(serverState)
+	ps.logger.Info("Player %s (%s) joined while the server is %s, disconnecting", loginStart.Name, client.RemoteAddr(), serverState)
+	return minecraft.WritePacket(client, minecraft.NewLoginDisconnect(minecraft.ChatComponent(message)))
+}
+
+// kickMessage returns the disconnect reason for a player joining while the server is in serverState.
+// A crashed server is not started again before its backoff has passed, and a stopping server only
+// after the stop, so players are told instead of being asked to retry right away.
+func (rt *route) kickMessage(serverState string) string {
+	switch serverState {
+	case stateStopping:
+		return cmp.Or(rt.login.StoppingMessage, defaultStoppingMessage)
+	case stateCrashed:
+		return cmp.Or(rt.login.CrashedMessage, defaultCrashedMessage)
+	default:
+		return cmp.Or(rt.login.StartingMessage, defaultStartingMessage)
+	}
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/config"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/modules/connector"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/testutil"
+)
+
+func TestKickMessage(t *testing.T) {
+	configured := &route{login: config.Login{
+		StartingMessage: "starting",
+		StoppingMessage: "stopping",
+		CrashedMessage:  "crashed",
+	}}
+	defaults := &route{}
+
+	tests := []struct {
+		state       string
+		want        string
+		wantDefault string
+	}{
+		{state: stateOff, want: "starting", wantDefault: defaultStartingMessage},
+		{state: stateStartingUp, want: "starting", wantDefault: defaultStartingMessage},
+		{state: stateStopping, want: "stopping", wantDefault: defaultStoppingMessage},
+		{state: stateCrashed, want: "crashed", wantDefault: defaultCrashedMessage},
+	}
+	for _, tt := range tests {
+		if got := configured.kickMessage(tt.state); got != tt.want {
+			t.Errorf("kickMessage(%s) = %q, want %q", tt.state, got, tt.want)
+		}
+		if got := defaults.kickMessage(tt.state); got != tt.wantDefault {
+			t.Errorf("kickMessage(%s) without messages = %q, want %q", tt.state, got, tt.wantDefault)
+		}
+	}
+}
+
+func TestWakeUpLogsOnlyUnexpectedErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantError bool
+	}{
+		{name: "woken up"},
+		{name: "crashed", err: fmt.Errorf("%w: in backoff", connector.ErrServerCrashed)},
+		{name: "rate limited", err: fmt.Errorf("%w: cooldown", connector.ErrRateLimited)},
+		{name: "not permitted", err: fmt.Errorf("%w: forbidden", connector.ErrNotPermitted), wantError: true},
+		{name: "loop busy", err: errors.New("connector unavailable"), wantError: true},
+	}
+	for _, tt := range tests {
+		fake := &fakeConnector{wakeErr: tt.err}
+		logger := &recordingLogger{Logger: testutil.Logger{T: t}}
+		(&route{connector: fake}).wakeUp(context.Background(), logger, "Steve")
+
+		testutil.Eventually(t, func() bool {
+			wakeups, _, _ := fake.counts()
+			return wakeups == 1
+		}, tt.name+": server was not woken up")
+		if tt.wantError {
+			testutil.Eventually(t, func() bool { return len(logger.logged()) == 1 }, tt.name+": wake-up failure was not logged as an error")
+			continue
+		}
+		if errs := logger.logged(); len(errs) != 0 {
+			t.Errorf("%s: logged errors %q, want none", tt.name, errs)
+		}
+	}
+}
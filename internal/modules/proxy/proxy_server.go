@@ -7,13 +7,32 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/sund3RRR/crafty-reverse-proxy/config"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/metrics"
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/minecraft"
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/proxyproto"
+)
+
+const (
+	// handshakeTimeout is the maximum time a client has to send its handshake.
+	handshakeTimeout = 10 * time.Second
+	// forceCloseTimeout is the maximum time to wait for sessions to end after their connections are closed.
+	forceCloseTimeout = 5 * time.Second
 )
 
 var (
 	// ErrStartingServer is returned when the proxy server fails to start.
 	ErrStartingServer = errors.New("error starting server")
+
+	// ErrInvalidRoutes is returned when the routes of a listener conflict with each other.
+	ErrInvalidRoutes = errors.New("invalid routes")
+
+	// ErrNoRoute is returned when no route matches the server address requested by a client.
+	ErrNoRoute = errors.New("no route for server address")
 )
 
 // Logger defines the logging interface used by ProxyServer.
@@ -26,37 +45,67 @@ type Logger interface {
 
 // Connector defines the interface for managing Minecraft server connections.
 type Connector interface {
-	StartLoop(ctx context.Context)
 	GetConnection(ctx context.Context) (net.Conn, error)
+	GetStatusConnection(ctx context.Context) (net.Conn, error)
 	PutConnection(ctx context.Context, conn net.Conn) error
+	PlayerJoined(ctx context.Context, conn net.Conn) error
+	WakeUp(ctx context.Context) error
+	ServerState() string
 }
 
 // Server handles proxying traffic between Minecraft clients and servers.
+// A single listener can serve several Minecraft servers, routed by the hostname in the handshake.
 type Server struct {
-	listenAddr string
-	targetAddr string
-	protocol   string
+	listenAddr          string
+	protocol            string
+	acceptProxyProtocol bool
+	drainTimeout        time.Duration
+	routes              []Route
 
-	logger    Logger
-	connector Connector
+	logger Logger
+	router *router
+
+	mu       sync.Mutex
+	clients  map[net.Conn]struct{}
+	sessions sync.WaitGroup
 }
 
-// New creates and returns a new ProxyServer instance based on the provided configuration.
-func New(proxyCfg config.ServerType, logger Logger, connector Connector) *Server {
+// New creates and returns a new ProxyServer instance listening on the address from the
+// listener configuration and serving the given routes. On shutdown, active sessions
+// are given drainTimeout to finish before they are closed.
+func New(listenerCfg config.ServerType, drainTimeout time.Duration, logger Logger, routes ...Route) *Server {
 	ps := &Server{
-		protocol:   proxyCfg.Protocol,
-		listenAddr: fmt.Sprintf("%s:%d", proxyCfg.Listener.Addr, proxyCfg.Listener.Port),
-		targetAddr: fmt.Sprintf("%s:%d", proxyCfg.CraftyHost.Addr, proxyCfg.CraftyHost.Port),
-		logger:     logger,
-		connector:  connector,
+		protocol:            listenerCfg.Protocol,
+		listenAddr:          fmt.Sprintf("%s:%d", listenerCfg.Listener.Addr, listenerCfg.Listener.Port),
+		acceptProxyProtocol: listenerCfg.AcceptProxyProtocol,
+		drainTimeout:        drainTimeout,
+		routes:              routes,
+		logger:              logger,
+		clients:             make(map[net.Conn]struct{}),
 	}
 	return ps
 }
 
 // ListenAndProxy starts the proxy server, listens for incoming client connections,
-// and forwards traffic to and from the Minecraft server.
+// and forwards traffic to and from the Minecraft servers.
+// When ctx is cancelled, the listener is closed and active sessions are drained before it returns.
 func (ps *Server) ListenAndProxy(ctx context.Context) error {
-	ps.connector.StartLoop(ctx)
+	routes := make([]*route, 0, len(ps.routes))
+	targets := make([]string, 0, len(ps.routes))
+	for _, r := range ps.routes {
+		rt, err := newRoute(r)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrStartingServer, err)
+		}
+		routes = append(routes, rt)
+		targets = append(targets, rt.targetAddr)
+	}
+
+	router, err := newRouter(routes)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrStartingServer, err)
+	}
+	ps.router = router
 
 	listener, err := net.Listen(ps.protocol, ps.listenAddr)
 	if err != nil {
@@ -64,33 +113,158 @@ func (ps *Server) ListenAndProxy(ctx context.Context) error {
 	}
 	defer func() {
 		listener.Close()
-		ps.logger.Info("Listener closed for external address: %s", ps.targetAddr)
+		ps.logger.Info("Listener closed for address: %s", ps.listenAddr)
+	}()
+
+	ps.logger.Info("%s: reverse proxy running on %s, forwarding to %s", ps.protocol, ps.listenAddr, strings.Join(targets, ", "))
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
 	}()
 
-	ps.logger.Info("%s: reverse proxy running on %s, forwarding to %s", ps.protocol, ps.listenAddr, ps.targetAddr)
+	// Sessions must be able to return their connections while draining, after ctx is cancelled.
+	sessionCtx := context.WithoutCancel(ctx)
 
 	for {
 		client, err := listener.Accept()
 		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
 			ps.logger.Error("Failed to accept connection: %v", err)
 			continue
 		}
 
+		ps.trackClient(client)
 		go func() {
-			if err := ps.handleClient(ctx, client); err != nil {
+			defer ps.untrackClient(client)
+			if err := ps.handleClient(sessionCtx, client); err != nil {
 				ps.logger.Error("Failed to handle client: %v", err)
 			}
 		}()
 	}
+
+	ps.drain()
+	return nil
+}
+
+// trackClient registers an active client session.
+func (ps *Server) trackClient(client net.Conn) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.clients[client] = struct{}{}
+	ps.sessions.Add(1)
+}
+
+// untrackClient unregisters a finished client session.
+func (ps *Server) untrackClient(client net.Conn) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	delete(ps.clients, client)
+	ps.sessions.Done()
+}
+
+// drain waits for active sessions to finish. Sessions still running after the drain timeout are closed.
+func (ps *Server) drain() {
+	done := make(chan struct{})
+	go func() {
+		ps.sessions.Wait()
+		close(done)
+	}()
+
+	ps.mu.Lock()
+	active := len(ps.clients)
+	ps.mu.Unlock()
+	if active > 0 {
+		ps.logger.Info("Draining %d active sessions on %s for up to %s", active, ps.listenAddr, ps.drainTimeout)
+	}
+
+	select {
+	case <-done:
+		return
+	case <-time.After(ps.drainTimeout):
+	}
+
+	ps.mu.Lock()
+	ps.logger.Warn("Drain timeout reached on %s, closing %d remaining sessions", ps.listenAddr, len(ps.clients))
+	for client := range ps.clients {
+		client.Close()
+	}
+	ps.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(forceCloseTimeout):
+		ps.logger.Warn("Sessions on %s did not finish after being closed", ps.listenAddr)
+	}
+}
+
+// handleClient reads the Minecraft handshake from the client, picks the route for the requested
+// hostname and decides how to serve it. Status requests for a server that is not available are
+// answered locally, everything else is proxied.
+func (ps *Server) handleClient(ctx context.Context, conn net.Conn) error {
+	defer conn.Close()
+
+	client := newSniffConn(conn)
+
+	_ = client.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	if ps.acceptProxyProtocol {
+		if err := client.ReadProxyHeader(); err != nil {
+			return fmt.Errorf("failed to read PROXY protocol header from %s: %w", conn.RemoteAddr(), err)
+		}
+	}
+
+	handshake, err := client.ReadHandshake()
+	if errors.Is(err, minecraft.ErrLegacyPing) {
+		ps.logger.Debug("Closing legacy server list ping from %s", client.RemoteAddr())
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read handshake from %s: %w", client.RemoteAddr(), err)
+	}
+	ps.logger.Debug("Handshake from %s: address %s, protocol %d, next state %d",
+		client.RemoteAddr(), handshake.ServerAddress, handshake.ProtocolVersion, handshake.NextState)
+
+	rt, ok := ps.router.match(handshake.ServerAddress)
+	if !ok {
+		return fmt.Errorf("%w %q from %s", ErrNoRoute, normalizeHostname(handshake.ServerAddress), client.RemoteAddr())
+	}
+	metrics.ConnectionsAccepted.Inc(rt.targetAddr)
+
+	if handshake.NextState == minecraft.NextStateStatus {
+		if entry, ok := rt.localStatus(rt.connector.ServerState()); ok {
+			return ps.serveStatus(client, rt, entry)
+		}
+	} else {
+		loginStart, err := client.ReadLoginStart()
+		if err != nil {
+			return fmt.Errorf("failed to read login start from %s: %w", client.RemoteAddr(), err)
+		}
+		ps.logger.Debug("Login start from %s: player %s", client.RemoteAddr(), loginStart.Name)
+
+		if rt.login.KickWhileStarting && !rt.isServerAvailable() {
+			return ps.kickWhileStarting(ctx, client, rt)
+		}
+	}
+	_ = client.SetReadDeadline(time.Time{})
+
+	return ps.proxy(ctx, client, rt)
 }
 
-// handleClient proxies data between the connected Minecraft client and server.
-func (ps *Server) handleClient(ctx context.Context, client net.Conn) error {
-	defer client.Close()
+// proxy connects to the Minecraft server of the route, replays the packets already read from
+// the client and proxies traffic in both directions until one of the sides closes.
+// Login sessions are reported to the connector as a joined player once they reach the play phase.
+func (ps *Server) proxy(ctx context.Context, client *sniffConn, rt *route) error {
+	login := client.Handshake().NextState != minecraft.NextStateStatus
+	getConnection := rt.connector.GetStatusConnection
+	if login {
+		getConnection = rt.connector.GetConnection
+	}
 
-	serverConnection, err := ps.connector.GetConnection(ctx)
+	serverConnection, err := getConnection(ctx)
 	defer func() {
-		err := ps.connector.PutConnection(ctx, serverConnection)
+		err := rt.connector.PutConnection(ctx, serverConnection)
 		if err != nil {
 			ps.logger.Error("Failed to put connection: %v", err)
 		}
@@ -99,6 +273,28 @@ func (ps *Server) handleClient(ctx context.Context, client net.Conn) error {
 		return err
 	}
 
+	if rt.proxyProtocol != "" {
+		if err := proxyproto.WriteHeader(serverConnection, rt.proxyProtocol, client.RemoteAddr(), client.LocalAddr()); err != nil {
+			return fmt.Errorf("failed to send PROXY protocol header to server: %w", err)
+		}
+	}
+
+	backend := rt.backendAddress(serverConnection)
+	toServer := countingWriter{writer: serverConnection, address: backend, direction: metrics.DirectionClientToServer}
+	var toClient io.Writer = countingWriter{writer: client, address: backend, direction: metrics.DirectionServerToClient}
+	if login {
+		toClient = newJoinWatcher(toClient, rt.login.JoinThreshold, func() {
+			ps.logger.Info("Player %s joined %s", client.LoginStart().Name, backend)
+			if err := rt.connector.PlayerJoined(ctx, serverConnection); err != nil {
+				ps.logger.Error("Failed to count player: %v", err)
+			}
+		})
+	}
+
+	if err := client.Replay(toServer); err != nil {
+		return fmt.Errorf("failed to replay handshake to server: %w", err)
+	}
+
 	ps.logger.Info("Starting proxy from %s to %s", client.RemoteAddr(), serverConnection.RemoteAddr())
 
 	completed := make(chan struct{})
@@ -107,17 +303,19 @@ func (ps *Server) handleClient(ctx context.Context, client net.Conn) error {
 			completed <- struct{}{}
 			close(completed)
 		}()
-		_, err := io.Copy(client, serverConnection)
+		_, err := io.Copy(toClient, serverConnection)
 		if err != nil {
 			ps.logger.Warn("An error occurred copying from server to client: %v", err)
 		}
 		ps.logger.Info("Proxying from %s to %s completed", client.RemoteAddr(), serverConnection.RemoteAddr())
 	}()
 
-	_, err = io.Copy(serverConnection, client)
+	_, err = io.Copy(toServer, client)
 	if err != nil {
 		ps.logger.Error("Error copying from client to server: %s", err)
 	}
+	// Closing the server side unblocks the copy in the other direction once the client is gone.
+	serverConnection.Close()
 
 	<-completed
 
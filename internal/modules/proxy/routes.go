@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/config"
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/proxyproto"
+)
+
+// wildcardHost matches any hostname and marks a route as the default one.
+const wildcardHost = "*"
+
+// Route binds the hostnames of a Minecraft server to the connector managing it.
+type Route struct {
+	Config    config.ServerType // Configuration of the Minecraft server behind the route
+	Connector Connector         // Connector managing the Minecraft server lifecycle
+}
+
+// route is a Route prepared for serving clients.
+type route struct {
+	hostnames  []string
+	targetAddr string
+	status     config.Status
+	login      config.Login
+	favicon    string
+	connector  Connector
+
+	proxyProtocol proxyproto.Version
+}
+
+// backendResolver is implemented by connectors spreading the players of a route over several Minecraft servers.
+type backendResolver interface {
+	BackendAddress(conn net.Conn) (string, bool)
+}
+
+// newRoute prepares a route by normalizing its hostnames and loading its favicon.
+func newRoute(r Route) (*route, error) {
+	favicon, err := loadFavicon(r.Config.Status.Favicon)
+	if err != nil {
+		return nil, err
+	}
+
+	hostnames := make([]string, 0, len(r.Config.Hostnames))
+	for _, hostname := range r.Config.Hostnames {
+		hostnames = append(hostnames, normalizeHostname(hostname))
+	}
+
+	switch r.Config.ProxyProtocol {
+	case "", proxyproto.V1, proxyproto.V2:
+	default:
+		return nil, fmt.Errorf("%w: %q", proxyproto.ErrUnsupportedVersion, r.Config.ProxyProtocol)
+	}
+
+	return &route{
+		hostnames:  hostnames,
+		targetAddr: r.Config.CraftyHost.String(),
+		status:     r.Config.Status,
+		login:      r.Config.Login,
+		favicon:    favicon,
+		connector:  r.Connector,
+
+		proxyProtocol: r.Config.ProxyProtocol,
+	}, nil
+}
+
+// backendAddress returns the address of the Minecraft server a connection of the route goes to,
+// which labels its metrics like the state of that server.
+func (rt *route) backendAddress(serverConnection net.Conn) string {
+	if resolver, ok := rt.connector.(backendResolver); ok {
+		if address, ok := resolver.BackendAddress(serverConnection); ok {
+			return address
+		}
+	}
+	return rt.targetAddr
+}
+
+// isDefault reports whether the route serves clients that match no other route.
+func (rt *route) isDefault() bool {
+	if len(rt.hostnames) == 0 {
+		return true
+	}
+	for _, hostname := range rt.hostnames {
+		if hostname == wildcardHost {
+			return true
+		}
+	}
+	return false
+}
+
+// router selects a route by the server address sent in the Minecraft handshake.
+type router struct {
+	exact        map[string]*route
+	wildcards    []wildcardRoute
+	defaultRoute *route
+}
+
+// wildcardRoute is a route matched by a "*.example.com" hostname pattern.
+type wildcardRoute struct {
+	suffix string // Pattern without the leading "*", e.g. ".example.com"
+	route  *route
+}
+
+// newRouter builds a router for the given routes.
+// The first route without hostnames or with the "*" hostname becomes the default route.
+func newRouter(routes []*route) (*router, error) {
+	rr := &router{exact: make(map[string]*route)}
+
+	for _, rt := range routes {
+		if rt.isDefault() {
+			if rr.defaultRoute != nil {
+				return nil, fmt.Errorf("%w: more than one default route", ErrInvalidRoutes)
+			}
+			rr.defaultRoute = rt
+		}
+
+		for _, hostname := range rt.hostnames {
+			switch {
+			case hostname == wildcardHost:
+			case strings.HasPrefix(hostname, "*."):
+				rr.wildcards = append(rr.wildcards, wildcardRoute{suffix: hostname[1:], route: rt})
+			default:
+				if _, exists := rr.exact[hostname]; exists {
+					return nil, fmt.Errorf("%w: duplicate hostname %s", ErrInvalidRoutes, hostname)
+				}
+				rr.exact[hostname] = rt
+			}
+		}
+	}
+
+	return rr, nil
+}
+
+// match returns the route for the given handshake server address.
+// Exact hostnames win over wildcards, and the longest wildcard wins over shorter ones.
+func (rr *router) match(serverAddress string) (*route, bool) {
+	hostname := normalizeHostname(serverAddress)
+
+	if rt, ok := rr.exact[hostname]; ok {
+		return rt, true
+	}
+
+	var best *wildcardRoute
+	for i, wildcard := range rr.wildcards {
+		if strings.HasSuffix(hostname, wildcard.suffix) && (best == nil || len(wildcard.suffix) > len(best.suffix)) {
+			best = &rr.wildcards[i]
+		}
+	}
+	if best != nil {
+		return best.route, true
+	}
+
+	return rr.defaultRoute, rr.defaultRoute != nil
+}
+
+// normalizeHostname strips data appended by modded clients (e.g. Forge's "\x00FML\x00"),
+// the trailing dot of fully qualified names and the letter case from a hostname.
+func normalizeHostname(hostname string) string {
+	hostname, _, _ = strings.Cut(hostname, "\x00")
+	hostname = strings.TrimSuffix(hostname, ".")
+	return strings.ToLower(hostname)
+}
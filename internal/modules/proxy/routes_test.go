@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/config"
+)
+
+// testRoute prepares a route for the given configured hostnames.
+func testRoute(t *testing.T, hostnames ...string) *route {
+	t.Helper()
+	rt, err := newRoute(Route{Config: config.ServerType{Hostnames: hostnames}})
+	if err != nil {
+		t.Fatalf("newRoute(%q) error = %v", hostnames, err)
+	}
+	return rt
+}
+
+func TestRouterMatch(t *testing.T) {
+	survival := testRoute(t, "Survival.Example.com.")
+	wildcard := testRoute(t, "*.example.com")
+	longWildcard := testRoute(t, "*.eu.example.com", "lobby.example.net")
+	fallback := testRoute(t)
+
+	rr, err := newRouter([]*route{survival, wildcard, longWildcard, fallback})
+	if err != nil {
+		t.Fatalf("newRouter() error = %v", err)
+	}
+
+	tests := []struct {
+		serverAddress string
+		want          *route
+	}{
+		{serverAddress: "survival.example.com", want: survival},
+		{serverAddress: "SURVIVAL.example.COM", want: survival},
+		{serverAddress: "survival.example.com.", want: survival},
+		{serverAddress: "survival.example.com\x00FML\x00", want: survival},
+		{serverAddress: "survival.example.com\x00FML3\x00", want: survival},
+		{serverAddress: "creative.example.com", want: wildcard},
+		{serverAddress: "survival.eu.example.com", want: longWildcard},
+		{serverAddress: "lobby.example.net", want: longWildcard},
+		{serverAddress: "example.com", want: fallback},
+		{serverAddress: "play.other.org", want: fallback},
+		{serverAddress: "203.0.113.7", want: fallback},
+	}
+	names := map[*route]string{survival: "survival", wildcard: "wildcard", longWildcard: "long wildcard", fallback: "fallback"}
+	for _, tt := range tests {
+		got, ok := rr.match(tt.serverAddress)
+		if !ok || got != tt.want {
+			t.Errorf("match(%q) = %q, %t, want %q", tt.serverAddress, names[got], ok, names[tt.want])
+		}
+	}
+}
+
+func TestRouterWithoutDefault(t *testing.T) {
+	rr, err := newRouter([]*route{testRoute(t, "survival.example.com")})
+	if err != nil {
+		t.Fatalf("newRouter() error = %v", err)
+	}
+	if _, ok := rr.match("creative.example.com"); ok {
+		t.Error("match() found a route without a default route")
+	}
+}
+
+func TestNewRouterRejectsConflicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes []*route
+	}{
+		{name: "two routes without hostnames", routes: []*route{testRoute(t), testRoute(t)}},
+		{name: "two catch-all routes", routes: []*route{testRoute(t, "*"), testRoute(t, "lobby.example.com", "*")}},
+		{name: "duplicate hostname", routes: []*route{testRoute(t, "mc.example.com"), testRoute(t, "MC.example.com.")}},
+	}
+	for _, tt := range tests {
+		if _, err := newRouter(tt.routes); !errors.Is(err, ErrInvalidRoutes) {
+			t.Errorf("%s: newRouter() error = %v, want %v", tt.name, err, ErrInvalidRoutes)
+		}
+	}
+}
+
+func TestNormalizeHostname(t *testing.T) {
+	tests := map[string]string{
+		"mc.example.com":                "mc.example.com",
+		"MC.Example.COM":                "mc.example.com",
+		"mc.example.com.":               "mc.example.com",
+		"mc.example.com\x00FML\x00":     "mc.example.com",
+		"MC.example.com.\x00FML2\x00":   "mc.example.com",
+		"mc.example.com\x00203.0.113.7": "mc.example.com",
+		"":                              "",
+	}
+	for hostname, want := range tests {
+		if got := normalizeHostname(hostname); got != want {
+			t.Errorf("normalizeHostname(%q) = %q, want %q", hostname, got, want)
+		}
+	}
+}
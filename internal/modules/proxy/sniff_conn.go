@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/minecraft"
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/proxyproto"
+)
+
+// sniffConn wraps a client connection and records every packet read through it,
+// so the packets inspected by the proxy can be replayed verbatim to the Minecraft server.
+// Once sniffing is done, Read returns the remaining client data, starting with anything
+// that was buffered but not consumed as a packet.
+type sniffConn struct {
+	net.Conn
+	reader   *bufio.Reader
+	recorder *recordingReader
+
+	handshake  minecraft.Handshake
+	loginStart minecraft.LoginStart
+
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+// newSniffConn wraps the given client connection.
+func newSniffConn(conn net.Conn) *sniffConn {
+	reader := bufio.NewReader(conn)
+	return &sniffConn{
+		Conn:     conn,
+		reader:   reader,
+		recorder: &recordingReader{reader: reader},
+	}
+}
+
+// ReadProxyHeader reads a PROXY protocol header sent by a load balancer in front of the proxy.
+// The header is not recorded, and the addresses it carries replace the connection's own ones.
+func (sc *sniffConn) ReadProxyHeader() error {
+	header, err := proxyproto.ReadHeader(sc.reader)
+	if err != nil {
+		return err
+	}
+	sc.remoteAddr = header.Source
+	sc.localAddr = header.Destination
+	return nil
+}
+
+// RemoteAddr returns the client address, as reported by the PROXY protocol header if one was read.
+func (sc *sniffConn) RemoteAddr() net.Addr {
+	if sc.remoteAddr != nil {
+		return sc.remoteAddr
+	}
+	return sc.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the client connected to, as reported by the PROXY protocol header if one was read.
+func (sc *sniffConn) LocalAddr() net.Addr {
+	if sc.localAddr != nil {
+		return sc.localAddr
+	}
+	return sc.Conn.LocalAddr()
+}
+
+// ReadPacket reads and records the next packet sent by the client. Only the small packets sent before the
+// client is connected to the server are read, so longer ones are rejected before being buffered.
+func (sc *sniffConn) ReadPacket() (minecraft.Packet, error) {
+	return minecraft.ReadPacketLimit(sc.recorder, minecraft.MaxHandshakeLength)
+}
+
+// ReadHandshake reads, records and parses the handshake packet.
+// minecraft.ErrLegacyPing is returned for the server list ping of clients before 1.7.
+func (sc *sniffConn) ReadHandshake() (minecraft.Handshake, error) {
+	if sc.legacyPing() {
+		return minecraft.Handshake{}, minecraft.ErrLegacyPing
+	}
+	packet, err := sc.ReadPacket()
+	if err != nil {
+		return minecraft.Handshake{}, err
+	}
+	sc.handshake, err = minecraft.ParseHandshake(packet)
+	return sc.handshake, err
+}
+
+// legacyPing peeks at the start of the client data for the server list ping of clients before 1.7,
+// which would otherwise be read as the length of a handshake that never arrives. Data starting like
+// the ping is waited on until enough has arrived to tell it from a handshake.
+func (sc *sniffConn) legacyPing() bool {
+	for n := 1; ; n++ {
+		received, err := sc.reader.Peek(n)
+		if err != nil {
+			return false
+		}
+		if legacy, decided := minecraft.IsLegacyPing(received); decided {
+			return legacy
+		}
+	}
+}
+
+// ReadLoginStart reads, records and parses the login start packet.
+func (sc *sniffConn) ReadLoginStart() (minecraft.LoginStart, error) {
+	packet, err := sc.ReadPacket()
+	if err != nil {
+		return minecraft.LoginStart{}, err
+	}
+	sc.loginStart, err = minecraft.ParseLoginStart(packet)
+	return sc.loginStart, err
+}
+
+// Handshake returns the parsed handshake packet.
+func (sc *sniffConn) Handshake() minecraft.Handshake {
+	return sc.handshake
+}
+
+// LoginStart returns the parsed login start packet, if one was read.
+func (sc *sniffConn) LoginStart() minecraft.LoginStart {
+	return sc.loginStart
+}
+
+// Replay writes the recorded packets to w exactly as they were received from the client.
+func (sc *sniffConn) Replay(w io.Writer) error {
+	_, err := w.Write(sc.recorder.recorded.Bytes())
+	return err
+}
+
+// Read reads client data that follows the sniffed packets.
+func (sc *sniffConn) Read(p []byte) (int, error) {
+	return sc.reader.Read(p)
+}
+
+// recordingReader records every byte read through it.
+type recordingReader struct {
+	reader   *bufio.Reader
+	recorded bytes.Buffer
+}
+
+// Read implements io.Reader.
+func (rr *recordingReader) Read(p []byte) (int, error) {
+	n, err := rr.reader.Read(p)
+	rr.recorded.Write(p[:n])
+	return n, err
+}
+
+// ReadByte implements io.ByteReader.
+func (rr *recordingReader) ReadByte() (byte, error) {
+	b, err := rr.reader.ReadByte()
+	if err == nil {
+		rr.recorded.WriteByte(b)
+	}
+	return b, err
+}
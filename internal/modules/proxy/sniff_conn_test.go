@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/minecraft"
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/proxyproto"
+)
+
+// sniff sends stream through a pipe and sniffs the handshake and login start from the other end.
+func sniff(t *testing.T, stream []byte, proxyHeader bool) *sniffConn {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() { server.Close() })
+	go func() {
+		defer client.Close()
+		// Small writes, so packets are split like they may be over TCP.
+		for len(stream) > 0 {
+			n := min(len(stream), 5)
+			if _, err := client.Write(stream[:n]); err != nil {
+				return
+			}
+			stream = stream[n:]
+		}
+	}()
+
+	sc := newSniffConn(server)
+	if proxyHeader {
+		if err := sc.ReadProxyHeader(); err != nil {
+			t.Fatalf("ReadProxyHeader() error = %v", err)
+		}
+	}
+	if _, err := sc.ReadHandshake(); err != nil {
+		t.Fatalf("ReadHandshake() error = %v", err)
+	}
+	if _, err := sc.ReadLoginStart(); err != nil {
+		t.Fatalf("ReadLoginStart() error = %v", err)
+	}
+	return sc
+}
+
+func TestSniffConnReplay(t *testing.T) {
+	handshake := minecraft.Handshake{ProtocolVersion: 767, ServerAddress: "mc.example.com", ServerPort: 25565, NextState: minecraft.NextStateLogin}
+	loginStart := minecraft.Packet{ID: minecraft.LoginStartPacketID, Data: append(minecraft.AppendString(nil, "Notch"), make([]byte, 16)...)}
+	sniffed := append(handshake.Marshal().Marshal(), loginStart.Marshal()...)
+	rest := []byte("encryption response and everything after it")
+
+	var header bytes.Buffer
+	source := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234}
+	if err := proxyproto.WriteHeader(&header, proxyproto.V1, source, &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 25565}); err != nil {
+		t.Fatalf("WriteHeader() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		proxyHeader bool
+	}{
+		{name: "without PROXY protocol header"},
+		{name: "with PROXY protocol header", proxyHeader: true},
+	}
+	for _, tt := range tests {
+		var stream []byte
+		if tt.proxyHeader {
+			stream = append(stream, header.Bytes()...)
+		}
+		stream = append(append(stream, sniffed...), rest...)
+
+		sc := sniff(t, stream, tt.proxyHeader)
+		if sc.Handshake() != handshake {
+			t.Errorf("%s: Handshake() = %+v, want %+v", tt.name, sc.Handshake(), handshake)
+		}
+		if name := sc.LoginStart().Name; name != "Notch" {
+			t.Errorf("%s: LoginStart().Name = %q, want %q", tt.name, name, "Notch")
+		}
+		if tt.proxyHeader && sc.RemoteAddr().String() != source.String() {
+			t.Errorf("%s: RemoteAddr() = %s, want %s", tt.name, sc.RemoteAddr(), source)
+		}
+
+		// The server receives the sniffed packets verbatim, followed by the rest of the stream.
+		var upstream bytes.Buffer
+		if err := sc.Replay(&upstream); err != nil {
+			t.Fatalf("%s: Replay() error = %v", tt.name, err)
+		}
+		if _, err := io.Copy(&upstream, sc); err != nil {
+			t.Fatalf("%s: reading the rest of the stream: %v", tt.name, err)
+		}
+		if want := append(append([]byte(nil), sniffed...), rest...); !bytes.Equal(upstream.Bytes(), want) {
+			t.Errorf("%s: upstream received %q, want %q", tt.name, upstream.Bytes(), want)
+		}
+	}
+}
+
+func TestSniffConnLegacyPing(t *testing.T) {
+	// A handshake of 254 bytes starts with the same bytes as the legacy ping up to the packet ID.
+	handshake := minecraft.Handshake{ProtocolVersion: 767, ServerAddress: string(bytes.Repeat([]byte{'a'}, 246)), ServerPort: 25565, NextState: minecraft.NextStateLogin}
+
+	tests := []struct {
+		name    string
+		stream  []byte
+		wantErr error
+	}{
+		{name: "legacy ping", stream: []byte{0xfe, 0x01, 0xfa, 0x00, 0x0b}, wantErr: minecraft.ErrLegacyPing},
+		{name: "handshake", stream: handshake.Marshal().Marshal()},
+	}
+	for _, tt := range tests {
+		client, server := net.Pipe()
+		go func() {
+			defer client.Close()
+			// One byte at a time, so the ping has to be told apart before all of it has arrived.
+			for _, b := range tt.stream {
+				if _, err := client.Write([]byte{b}); err != nil {
+					return
+				}
+			}
+		}()
+
+		got, err := newSniffConn(server).ReadHandshake()
+		server.Close()
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: ReadHandshake() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if tt.wantErr == nil && got.ServerAddress != handshake.ServerAddress {
+			t.Errorf("%s: ReadHandshake() server address = %q, want %q", tt.name, got.ServerAddress, handshake.ServerAddress)
+		}
+	}
+}
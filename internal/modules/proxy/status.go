@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/config"
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/minecraft"
+)
+
+// Connector state names the proxy can answer status requests for.
+const (
+	stateOff        = "Off"
+	stateStartingUp = "StartingUp"
+	stateRunning    = "Running"
+	stateEmpty      = "Empty"
+	stateStopping   = "Stopping"
+	stateCrashed    = "Crashed"
+)
+
+const (
+	// defaultMaxPlayers is the max players value reported when none is configured.
+	defaultMaxPlayers = 20
+	// faviconPrefix is the data URI prefix expected by the client for the server icon.
+	faviconPrefix = "data:image/png;base64,"
+	// statusProtocolVersion is reported in locally served statuses. Java clients only show the version
+	// label of a server whose protocol does not match their own, so it never matches.
+	statusProtocolVersion = -1
+)
+
+// defaultStatuses holds the server list entries used when a state has no configured MOTD.
+var defaultStatuses = map[string]config.StateStatus{
+	stateOff: {
+		MOTD:        "&7Server is sleeping. &aJoin to start it!",
+		VersionName: "Sleeping",
+	},
+	stateStartingUp: {
+		MOTD:        "&eServer is starting, please wait...",
+		VersionName: "Starting...",
+	},
+}
+
+// loadFavicon reads the configured favicon and encodes it as a data URI.
+func loadFavicon(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return "", fmt.Errorf("failed to read favicon: %w", err)
+	}
+	return faviconPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// localStatus returns the server list entry the proxy should serve for the given connector state.
+// The second return value is false if status requests in this state should reach the server.
+func (rt *route) localStatus(serverState string) (config.StateStatus, bool) {
+	var configured config.StateStatus
+	switch serverState {
+	case stateStopping, stateCrashed:
+		// A stopping or crashed server cannot answer and is started again when a player joins.
+		serverState = stateOff
+		configured = rt.status.Off
+	case stateOff:
+		configured = rt.status.Off
+	case stateStartingUp:
+		configured = rt.status.StartingUp
+	case stateEmpty:
+		configured = rt.status.Empty
+	default:
+		return config.StateStatus{}, false
+	}
+
+	defaults, hasDefaults := defaultStatuses[serverState]
+	if configured.MOTD == "" && !hasDefaults {
+		// The running server answers for itself unless a MOTD is configured for this state.
+		return config.StateStatus{}, false
+	}
+	if configured.MOTD == "" {
+		configured.MOTD = defaults.MOTD
+	}
+	if configured.VersionName == "" {
+		configured.VersionName = defaults.VersionName
+	}
+	return configured, true
+}
+
+// serveStatus answers a server list ping on behalf of the Minecraft server.
+// It replies to the status request with the given entry and echoes the ping payload.
+func (ps *Server) serveStatus(client *sniffConn, rt *route, entry config.StateStatus) error {
+	request, err := client.ReadPacket()
+	if err != nil {
+		return fmt.Errorf("failed to read status request: %w", err)
+	}
+	if request.ID != minecraft.StatusRequestPacketID {
+		return fmt.Errorf("%w: expected status request, got id 0x%02x", minecraft.ErrUnexpectedPacket, request.ID)
+	}
+
+	maxPlayers := rt.status.MaxPlayers
+	if maxPlayers == 0 {
+		maxPlayers = defaultMaxPlayers
+	}
+
+	response, err := minecraft.NewStatusResponse(minecraft.Status{
+		Version: minecraft.StatusVersion{
+			Name:     entry.VersionName,
+			Protocol: statusProtocolVersion,
+		},
+		Players: minecraft.StatusPlayers{
+			Max:    maxPlayers,
+			Online: 0,
+		},
+		Description: minecraft.ChatComponent(entry.MOTD),
+		Favicon:     rt.favicon,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build status response: %w", err)
+	}
+	if err := minecraft.WritePacket(client, response); err != nil {
+		return fmt.Errorf("failed to write status response: %w", err)
+	}
+
+	ping, err := client.ReadPacket()
+	if err != nil {
+		// Some clients close the connection right after receiving the status.
+		ps.logger.Debug("Client %s closed connection before ping: %v", client.RemoteAddr(), err)
+		return nil
+	}
+	payload, err := minecraft.ParsePing(ping)
+	if err != nil {
+		return err
+	}
+
+	return minecraft.WritePacket(client, minecraft.NewPong(payload))
+}
@@ -0,0 +1,407 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/config"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/metrics"
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/minecraft"
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/raknet"
+)
+
+const (
+	// udpBufferSize is large enough for any RakNet datagram (the maximum MTU Bedrock negotiates is 1492).
+	udpBufferSize = 1500
+	// defaultSessionTimeout is the idle time after which a UDP session is closed if none is configured.
+	defaultSessionTimeout = 30 * time.Second
+	// pingForwardTimeout is the time to wait for the server to answer a forwarded ping.
+	pingForwardTimeout = time.Second
+	// bedrockProtocolVersion is the Bedrock protocol version advertised while the server is not available.
+	bedrockProtocolVersion = 766
+)
+
+// UDPServer proxies Minecraft Bedrock Edition (RakNet over UDP) traffic to a single Minecraft server.
+// Every client address gets its own upstream socket, which counts as a connection of the connector.
+type UDPServer struct {
+	listenAddr     string
+	listenPort     int
+	sessionTimeout time.Duration
+	drainTimeout   time.Duration
+	routes         []Route
+
+	logger   Logger
+	rt       *route
+	guid     int64
+	listener *net.UDPConn
+
+	mu       sync.Mutex
+	sessions map[string]*udpSession
+	pending  map[string]struct{}
+}
+
+// udpSession is the upstream socket of a single Bedrock client.
+type udpSession struct {
+	client    *net.UDPAddr
+	upstream  net.Conn
+	backend   string // Address of the Minecraft server the session goes to
+	lastSeen  atomic.Int64
+	closeOnce sync.Once
+}
+
+// touch marks the session as active.
+func (s *udpSession) touch() {
+	s.lastSeen.Store(time.Now().UnixNano())
+}
+
+// idleFor returns the time since the session was last active.
+func (s *udpSession) idleFor() time.Duration {
+	return time.Since(time.Unix(0, s.lastSeen.Load()))
+}
+
+// NewUDP creates and returns a new UDPServer listening on the address from the listener configuration.
+// UDP listeners cannot route by hostname, so exactly one route is expected. On shutdown, active
+// sessions are given drainTimeout to finish before they are closed.
+func NewUDP(listenerCfg config.ServerType, drainTimeout time.Duration, logger Logger, routes ...Route) *UDPServer {
+	sessionTimeout := listenerCfg.SessionTimeout
+	if sessionTimeout == 0 {
+		sessionTimeout = defaultSessionTimeout
+	}
+
+	return &UDPServer{
+		listenAddr:     fmt.Sprintf("%s:%d", listenerCfg.Listener.Addr, listenerCfg.Listener.Port),
+		listenPort:     listenerCfg.Listener.Port,
+		sessionTimeout: sessionTimeout,
+		drainTimeout:   drainTimeout,
+		routes:         routes,
+		logger:         logger,
+		guid:           rand.Int64(), //nolint:gosec
+		sessions:       make(map[string]*udpSession),
+		pending:        make(map[string]struct{}),
+	}
+}
+
+// ListenAndProxy starts the UDP proxy, tracks client sessions
+// and forwards datagrams to and from the Minecraft server.
+// When ctx is cancelled, the listener is closed and active sessions are drained before it returns.
+func (us *UDPServer) ListenAndProxy(ctx context.Context) error {
+	if len(us.routes) != 1 {
+		return fmt.Errorf("%w: %w: udp listener %s needs exactly one address, got %d",
+			ErrStartingServer, ErrInvalidRoutes, us.listenAddr, len(us.routes))
+	}
+	rt, err := newRoute(us.routes[0])
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrStartingServer, err)
+	}
+	us.rt = rt
+
+	udpAddr, err := net.ResolveUDPAddr("udp", us.listenAddr)
+	if err != nil {
+		return fmt.Errorf("%w with protocol udp, err: %w", ErrStartingServer, err)
+	}
+	listener, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return fmt.Errorf("%w with protocol udp, err: %w", ErrStartingServer, err)
+	}
+	us.listener = listener
+	defer func() {
+		listener.Close()
+		us.logger.Info("Listener closed for address: %s", us.listenAddr)
+	}()
+
+	// Sessions must be able to return their connections while draining, after ctx is cancelled.
+	sessionCtx := context.WithoutCancel(ctx)
+	go us.expireSessions(sessionCtx)
+
+	us.logger.Info("udp: reverse proxy running on %s, forwarding to %s", us.listenAddr, rt.targetAddr)
+
+	// The listener keeps serving existing sessions while draining and is closed afterwards.
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		us.drain(sessionCtx)
+		listener.Close()
+	}()
+
+	buf := make([]byte, udpBufferSize)
+	for {
+		n, client, err := listener.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				break
+			}
+			us.logger.Error("Failed to read datagram: %v", err)
+			continue
+		}
+		us.handleDatagram(sessionCtx, client, append([]byte(nil), buf[:n]...), ctx.Err() == nil)
+	}
+
+	<-drained
+	return nil
+}
+
+// drain waits for the sessions to end or expire. Sessions still open after the drain timeout are closed.
+func (us *UDPServer) drain(ctx context.Context) {
+	if active := us.sessionCount(); active > 0 {
+		us.logger.Info("Draining %d active sessions on %s for up to %s", active, us.listenAddr, us.drainTimeout)
+	}
+
+	deadline := time.After(us.drainTimeout)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for us.sessionCount() > 0 {
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			us.mu.Lock()
+			sessions := make([]*udpSession, 0, len(us.sessions))
+			for _, session := range us.sessions {
+				sessions = append(sessions, session)
+			}
+			us.mu.Unlock()
+
+			us.logger.Warn("Drain timeout reached on %s, closing %d remaining sessions", us.listenAddr, len(sessions))
+			for _, session := range sessions {
+				us.closeSession(ctx, session)
+			}
+			return
+		}
+	}
+}
+
+// sessionCount returns the number of open sessions.
+func (us *UDPServer) sessionCount() int {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	return len(us.sessions)
+}
+
+// handleDatagram forwards a datagram of a known client, or handles the offline message of a new one.
+// Datagrams of new clients are dropped when the server is no longer accepting sessions.
+func (us *UDPServer) handleDatagram(ctx context.Context, client *net.UDPAddr, data []byte, accepting bool) {
+	us.mu.Lock()
+	session, exists := us.sessions[client.String()]
+	_, isPending := us.pending[client.String()]
+	us.mu.Unlock()
+
+	if exists {
+		session.touch()
+		metrics.BytesProxied.Add(float64(len(data)), session.backend, metrics.DirectionClientToServer)
+		if _, err := session.upstream.Write(data); err != nil {
+			us.logger.Warn("Failed to forward datagram from %s: %v", client, err)
+		}
+		return
+	}
+	if !accepting {
+		return
+	}
+
+	switch {
+	case raknet.IsPing(data):
+		us.handlePing(ctx, client, data)
+	case raknet.IsOpenConnectionRequest(data) && !isPending:
+		us.handleOpenConnection(ctx, client, data)
+	default:
+		us.logger.Debug("Dropping datagram 0x%02x from %s without a session", data[0], client)
+	}
+}
+
+// handlePing answers a server list ping locally while the server is not available,
+// and forwards it to the server otherwise.
+func (us *UDPServer) handlePing(ctx context.Context, client *net.UDPAddr, data []byte) {
+	ping, err := raknet.ParsePing(data)
+	if err != nil {
+		us.logger.Debug("Invalid ping from %s: %v", client, err)
+		return
+	}
+
+	entry, ok := us.rt.localStatus(us.rt.connector.ServerState())
+	if !ok {
+		go us.forwardPing(ctx, client, data)
+		return
+	}
+
+	maxPlayers := us.rt.status.MaxPlayers
+	if maxPlayers == 0 {
+		maxPlayers = defaultMaxPlayers
+	}
+
+	status := raknet.BedrockStatus{
+		MOTD:            bedrockText(entry.MOTD),
+		SubMOTD:         bedrockText(entry.VersionName),
+		ProtocolVersion: bedrockProtocolVersion,
+		VersionName:     bedrockText(entry.VersionName),
+		Online:          0,
+		Max:             maxPlayers,
+		ServerGUID:      us.guid,
+		PortV4:          us.listenPort,
+		PortV6:          us.listenPort,
+	}
+	pong := raknet.UnconnectedPong{Time: ping.Time, ServerGUID: us.guid, ServerID: status.ServerID()}
+	if _, err := us.listener.WriteToUDP(pong.Marshal(), client); err != nil {
+		us.logger.Warn("Failed to send pong to %s: %v", client, err)
+	}
+}
+
+// forwardPing relays a ping to the running server and its pong back to the client,
+// without opening a session, so pings don't count as players. The upstream socket is a status
+// connection of the connector, so a balanced route pings a backend that players are sent to.
+func (us *UDPServer) forwardPing(ctx context.Context, client *net.UDPAddr, data []byte) {
+	pingCtx, cancel := context.WithTimeout(ctx, pingForwardTimeout)
+	defer cancel()
+
+	upstream, err := us.rt.connector.GetStatusConnection(pingCtx)
+	if err != nil {
+		us.logger.Warn("Failed to forward ping from %s: %v", client, err)
+		return
+	}
+	defer func() {
+		if err := us.rt.connector.PutConnection(ctx, upstream); err != nil {
+			us.logger.Error("Failed to put connection: %v", err)
+		}
+	}()
+
+	_ = upstream.SetDeadline(time.Now().Add(pingForwardTimeout))
+	if _, err := upstream.Write(data); err != nil {
+		us.logger.Warn("Failed to forward ping from %s: %v", client, err)
+		return
+	}
+	buf := make([]byte, udpBufferSize)
+	n, err := upstream.Read(buf)
+	if err != nil {
+		us.logger.Debug("No pong from server for %s: %v", client, err)
+		return
+	}
+	if _, err := us.listener.WriteToUDP(buf[:n], client); err != nil {
+		us.logger.Warn("Failed to send pong to %s: %v", client, err)
+	}
+}
+
+// handleOpenConnection wakes the server up if it is not running, or opens a session if it is available.
+// While the server is starting, connection requests are dropped and the client retries or times out.
+func (us *UDPServer) handleOpenConnection(ctx context.Context, client *net.UDPAddr, data []byte) {
+	if !us.rt.isServerAvailable() {
+		if us.rt.connector.ServerState() != stateStartingUp {
+			us.logger.Info("Bedrock client %s is connecting, waking up the server", client)
+			us.rt.wakeUp(ctx, us.logger, client.String())
+		}
+		return
+	}
+
+	us.mu.Lock()
+	us.pending[client.String()] = struct{}{}
+	us.mu.Unlock()
+
+	go us.openSession(ctx, client, data)
+}
+
+// openSession obtains an upstream socket from the connector and starts relaying server datagrams.
+func (us *UDPServer) openSession(ctx context.Context, client *net.UDPAddr, first []byte) {
+	defer func() {
+		us.mu.Lock()
+		delete(us.pending, client.String())
+		us.mu.Unlock()
+	}()
+
+	upstream, err := us.rt.connector.GetConnection(ctx)
+	if err != nil {
+		us.logger.Error("Failed to open session for %s: %v", client, err)
+		return
+	}
+
+	// Bedrock sessions are only opened for connection requests, so every session is a player.
+	if err := us.rt.connector.PlayerJoined(ctx, upstream); err != nil {
+		us.logger.Error("Failed to count player: %v", err)
+	}
+
+	session := &udpSession{client: client, upstream: upstream, backend: us.rt.backendAddress(upstream)}
+	session.touch()
+
+	us.mu.Lock()
+	us.sessions[client.String()] = session
+	us.mu.Unlock()
+
+	us.logger.Info("Starting proxy from %s to %s", client, upstream.RemoteAddr())
+	metrics.ConnectionsAccepted.Inc(session.backend)
+	metrics.BytesProxied.Add(float64(len(first)), session.backend, metrics.DirectionClientToServer)
+
+	if _, err := upstream.Write(first); err != nil {
+		us.logger.Warn("Failed to forward datagram from %s: %v", client, err)
+	}
+	us.relayUpstream(ctx, session)
+}
+
+// relayUpstream copies datagrams from the server to the client until the session is closed.
+func (us *UDPServer) relayUpstream(ctx context.Context, session *udpSession) {
+	buf := make([]byte, udpBufferSize)
+	for {
+		n, err := session.upstream.Read(buf)
+		if err != nil {
+			us.closeSession(ctx, session)
+			return
+		}
+		session.touch()
+		metrics.BytesProxied.Add(float64(n), session.backend, metrics.DirectionServerToClient)
+		if _, err := us.listener.WriteToUDP(buf[:n], session.client); err != nil {
+			us.logger.Warn("Failed to forward datagram to %s: %v", session.client, err)
+		}
+	}
+}
+
+// expireSessions periodically closes sessions that have been idle for longer than the session timeout.
+func (us *UDPServer) expireSessions(ctx context.Context) {
+	ticker := time.NewTicker(us.sessionTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var expired []*udpSession
+			us.mu.Lock()
+			for _, session := range us.sessions {
+				if session.idleFor() > us.sessionTimeout {
+					expired = append(expired, session)
+				}
+			}
+			us.mu.Unlock()
+
+			for _, session := range expired {
+				us.closeSession(ctx, session)
+			}
+		}
+	}
+}
+
+// closeSession removes the session and returns its upstream socket to the connector.
+func (us *UDPServer) closeSession(ctx context.Context, session *udpSession) {
+	session.closeOnce.Do(func() {
+		us.mu.Lock()
+		if us.sessions[session.client.String()] == session {
+			delete(us.sessions, session.client.String())
+		}
+		us.mu.Unlock()
+
+		us.logger.Info("Proxying from %s to %s completed", session.client, session.upstream.RemoteAddr())
+		if err := us.rt.connector.PutConnection(ctx, session.upstream); err != nil {
+			us.logger.Error("Failed to put connection: %v", err)
+			session.upstream.Close()
+		}
+	})
+}
+
+// bedrockText converts configured text for the Bedrock server list, which supports
+// '§' formatting codes but no JSON components and uses ';' as a field separator.
+func bedrockText(text string) string {
+	return strings.ReplaceAll(minecraft.TranslateColorCodes(text), ";", ",")
+}
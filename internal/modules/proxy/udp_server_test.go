@@ -0,0 +1,288 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sund3RRR/crafty-reverse-proxy/config"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/modules/connector"
+	"github.com/sund3RRR/crafty-reverse-proxy/internal/testutil"
+	"github.com/sund3RRR/crafty-reverse-proxy/pkg/raknet"
+)
+
+const (
+	// backendServerID is the server ID in the pongs of the fake Bedrock server.
+	backendServerID = "MCPE;backend;766;1.21;0;10"
+	// loginRequest and statusRequest are the kinds of connections requested from a fakeConnector.
+	loginRequest  = "login"
+	statusRequest = "status"
+)
+
+// fakeConnector is a Connector dialing a fake Bedrock server and recording what the proxy asks for.
+type fakeConnector struct {
+	mu       sync.Mutex
+	state    string
+	backend  string
+	wakeErr  error
+	wakeups  int
+	requests []string // Kind of every requested connection
+	joined   int
+	puts     int
+}
+
+func (f *fakeConnector) dial(kind string) (net.Conn, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, kind)
+	f.mu.Unlock()
+	return net.Dial("udp", f.backend)
+}
+
+func (f *fakeConnector) GetConnection(context.Context) (net.Conn, error) {
+	return f.dial(loginRequest)
+}
+
+func (f *fakeConnector) GetStatusConnection(context.Context) (net.Conn, error) {
+	return f.dial(statusRequest)
+}
+
+func (f *fakeConnector) PutConnection(_ context.Context, conn net.Conn) error {
+	f.mu.Lock()
+	f.puts++
+	f.mu.Unlock()
+	return conn.Close()
+}
+
+func (f *fakeConnector) PlayerJoined(context.Context, net.Conn) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.joined++
+	return nil
+}
+
+func (f *fakeConnector) WakeUp(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.wakeups++
+	return f.wakeErr
+}
+
+func (f *fakeConnector) ServerState() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state
+}
+
+func (f *fakeConnector) setState(state string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.state = state
+}
+
+// counts returns the number of wake-ups, joined players and returned connections.
+func (f *fakeConnector) counts() (wakeups, joined, puts int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.wakeups, f.joined, f.puts
+}
+
+func (f *fakeConnector) requested() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+// recordingLogger is a test logger that also records the errors it logs.
+type recordingLogger struct {
+	testutil.Logger
+	mu     sync.Mutex
+	errors []string
+}
+
+func (l *recordingLogger) Error(format string, args ...any) {
+	l.Logger.Error(format, args...)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) logged() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.errors...)
+}
+
+// serveBedrock runs a fake Bedrock server answering pings with backendServerID and echoing any other datagram.
+func serveBedrock(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, udpBufferSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			reply := buf[:n]
+			if ping, err := raknet.ParsePing(reply); err == nil {
+				reply = raknet.UnconnectedPong{Time: ping.Time, ServerGUID: 1, ServerID: backendServerID}.Marshal()
+			}
+			_, _ = conn.WriteTo(reply, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// startUDP runs a UDP proxy for connector and returns a client socket connected to it.
+func startUDP(t *testing.T, connector *fakeConnector, logger Logger) net.Conn {
+	t.Helper()
+	// The proxy reports no address, so it listens on a port that was free a moment ago.
+	probe, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := probe.LocalAddr().(*net.UDPAddr).Port
+	probe.Close()
+
+	listenerCfg := config.ServerType{
+		Protocol:   "udp",
+		Listener:   config.Host{Addr: "127.0.0.1", Port: port},
+		CraftyHost: config.Host{Addr: "127.0.0.1", Port: 1},
+	}
+	server := NewUDP(listenerCfg, 10*time.Millisecond, logger, Route{Config: listenerCfg, Connector: connector})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		if err := server.ListenAndProxy(ctx); err != nil {
+			t.Errorf("ListenAndProxy() error = %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+
+	client, err := net.Dial("udp", listenerCfg.Listener.String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// exchange sends data until a reply arrives, as datagrams sent before the proxy listens are lost.
+func exchange(t *testing.T, client net.Conn, data []byte) []byte {
+	t.Helper()
+	buf := make([]byte, udpBufferSize)
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := client.Write(data); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		_ = client.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		if n, err := client.Read(buf); err == nil {
+			return buf[:n]
+		}
+	}
+	t.Fatal("no reply from the proxy")
+	return nil
+}
+
+// ping sends an unconnected ping through client and returns the server ID of the pong.
+func ping(t *testing.T, client net.Conn) string {
+	t.Helper()
+	pong, err := raknet.ParsePong(exchange(t, client, raknet.UnconnectedPing{Time: 1, ClientGUID: 2}.Marshal()))
+	if err != nil {
+		t.Fatalf("ParsePong() error = %v", err)
+	}
+	return pong.ServerID
+}
+
+func TestUDPPingForwardedThroughConnector(t *testing.T) {
+	connector := &fakeConnector{state: stateRunning, backend: serveBedrock(t)}
+	client := startUDP(t, connector, testutil.Logger{T: t})
+
+	if serverID := ping(t, client); serverID != backendServerID {
+		t.Errorf("pong server ID = %q, want %q", serverID, backendServerID)
+	}
+	testutil.Eventually(t, func() bool {
+		_, _, puts := connector.counts()
+		return puts > 0
+	}, "ping connection was not returned to the connector")
+	for _, kind := range connector.requested() {
+		if kind != statusRequest {
+			t.Errorf("ping requested a %s connection, want status", kind)
+		}
+	}
+}
+
+func TestUDPPingAnsweredLocally(t *testing.T) {
+	connector := &fakeConnector{state: stateOff, backend: serveBedrock(t)}
+	client := startUDP(t, connector, testutil.Logger{T: t})
+
+	if serverID := ping(t, client); !strings.HasPrefix(serverID, "MCPE;") || serverID == backendServerID {
+		t.Errorf("pong server ID = %q, want a local status", serverID)
+	}
+	if requests := connector.requested(); len(requests) != 0 {
+		t.Errorf("local ping requested connections %q", requests)
+	}
+}
+
+func TestUDPOfflineHandshake(t *testing.T) {
+	fake := &fakeConnector{
+		state:   stateCrashed,
+		backend: serveBedrock(t),
+		wakeErr: fmt.Errorf("%w: in backoff", connector.ErrServerCrashed),
+	}
+	logger := &recordingLogger{Logger: testutil.Logger{T: t}}
+	client := startUDP(t, fake, logger)
+	ping(t, client) // The proxy is listening once it answers.
+
+	magic := raknet.UnconnectedPing{}.Marshal()[9:25]
+	request := append(append([]byte{raknet.OpenConnectionRequest1ID}, magic...), 11, 0, 0, 0)
+
+	// While the server is not available, connection requests only wake it up.
+	if _, err := client.Write(request); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	testutil.Eventually(t, func() bool {
+		wakeups, _, _ := fake.counts()
+		return wakeups == 1
+	}, "connection request did not wake the server up")
+	if errs := logger.logged(); len(errs) != 0 {
+		t.Errorf("expected wake-up failure logged as errors: %q", errs)
+	}
+	if requests := fake.requested(); len(requests) != 0 {
+		t.Errorf("connection request of an unavailable server requested connections %q", requests)
+	}
+
+	// Once it runs, the request opens a session relaying datagrams both ways.
+	fake.setState(stateRunning)
+	if reply := exchange(t, client, request); !bytes.Equal(reply, request) {
+		t.Errorf("relayed reply = %x, want %x", reply, request)
+	}
+	if requests := fake.requested(); len(requests) != 1 || requests[0] != loginRequest {
+		t.Errorf("session requested connections %q, want one %s connection", requests, loginRequest)
+	}
+	testutil.Eventually(t, func() bool {
+		_, joined, _ := fake.counts()
+		return joined == 1
+	}, "session was not counted as a player")
+
+	datagram := []byte{0x84, 0, 0, 0, 'd', 'a', 't', 'a'}
+	if reply := exchange(t, client, datagram); !bytes.Equal(reply, datagram) {
+		t.Errorf("relayed reply = %x, want %x", reply, datagram)
+	}
+}
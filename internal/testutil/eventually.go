@@ -0,0 +1,18 @@
+package testutil
+
+import (
+	"testing"
+	"time"
+)
+
+// Eventually fails the test with msg if cond does not hold within a second.
+func Eventually(t testing.TB, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
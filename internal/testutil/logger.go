@@ -0,0 +1,21 @@
+// Package testutil provides helpers shared by the tests of the internal packages.
+package testutil
+
+import "testing"
+
+// Logger writes log messages to the test log, so they are only shown for failed or verbose tests.
+type Logger struct {
+	T testing.TB
+}
+
+// Debug logs a debug message.
+func (l Logger) Debug(format string, args ...any) { l.T.Logf("DEBUG "+format, args...) }
+
+// Warn logs a warning.
+func (l Logger) Warn(format string, args ...any) { l.T.Logf("WARN "+format, args...) }
+
+// Info logs an informational message.
+func (l Logger) Info(format string, args ...any) { l.T.Logf("INFO "+format, args...) }
+
+// Error logs an error.
+func (l Logger) Error(format string, args ...any) { l.T.Logf("ERROR "+format, args...) }
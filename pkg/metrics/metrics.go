@@ -0,0 +1,315 @@
+// Package metrics implements a minimal metrics registry exposed in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// contentType is the content type of the Prometheus text exposition format.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// collector is a metric family that can write itself in the text exposition format.
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds metric families and exposes them over HTTP.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Expose writes all registered metric families to w.
+func (r *Registry) Expose(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	r.Expose(w)
+}
+
+// family holds the metadata and labelled series of a metric family.
+type family[T any] struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*T
+	values map[string][]string
+}
+
+func newFamily[T any](name, help, kind string, labels []string) *family[T] {
+	return &family[T]{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: make(map[string]*T),
+		values: make(map[string][]string),
+	}
+}
+
+// get returns the series for the given label values, creating it with create if needed.
+func (f *family[T]) get(labelValues []string, create func() *T) *T {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok := f.series[key]; ok {
+		return s
+	}
+	s := create()
+	f.series[key] = s
+	f.values[key] = append([]string(nil), labelValues...)
+	return s
+}
+
+// each calls fn for every series in a stable order.
+func (f *family[T]) each(fn func(labels string, s *T)) {
+	f.mu.Lock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	series := make([]*T, len(keys))
+	labels := make([]string, len(keys))
+	for i, key := range keys {
+		series[i] = f.series[key]
+		labels[i] = formatLabels(f.labels, f.values[key])
+	}
+	f.mu.Unlock()
+
+	for i := range keys {
+		fn(labels[i], series[i])
+	}
+}
+
+func (f *family[T]) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.kind)
+}
+
+// value is a float64 series protected by a mutex.
+type value struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (v *value) add(delta float64) {
+	v.mu.Lock()
+	v.v += delta
+	v.mu.Unlock()
+}
+
+func (v *value) set(x float64) {
+	v.mu.Lock()
+	v.v = x
+	v.mu.Unlock()
+}
+
+func (v *value) get() float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.v
+}
+
+// CounterVec is a family of monotonically increasing counters.
+type CounterVec struct {
+	*family[value]
+}
+
+// NewCounterVec creates and registers a counter family.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newFamily[value](name, help, "counter", labels)}
+	r.register(c)
+	return c
+}
+
+// Inc increments the counter with the given label values by one.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter with the given label values by delta.
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	c.get(labelValues, func() *value { return &value{} }).add(delta)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.writeHeader(w)
+	c.each(func(labels string, s *value) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labels, formatFloat(s.get()))
+	})
+}
+
+// GaugeVec is a family of values that can go up and down.
+type GaugeVec struct {
+	*family[value]
+}
+
+// NewGaugeVec creates and registers a gauge family.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newFamily[value](name, help, "gauge", labels)}
+	r.register(g)
+	return g
+}
+
+// Set sets the gauge with the given label values.
+func (g *GaugeVec) Set(x float64, labelValues ...string) {
+	g.get(labelValues, func() *value { return &value{} }).set(x)
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.writeHeader(w)
+	g.each(func(labels string, s *value) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, labels, formatFloat(s.get()))
+	})
+}
+
+// GaugeFuncVec is a family of gauges whose values are read from callbacks at scrape time.
+type GaugeFuncVec struct {
+	*family[func() float64]
+}
+
+// NewGaugeFuncVec creates and registers a callback gauge family.
+func (r *Registry) NewGaugeFuncVec(name, help string, labels ...string) *GaugeFuncVec {
+	g := &GaugeFuncVec{newFamily[func() float64](name, help, "gauge", labels)}
+	r.register(g)
+	return g
+}
+
+// Register sets the callback of the gauge with the given label values.
+func (g *GaugeFuncVec) Register(fn func() float64, labelValues ...string) {
+	*g.get(labelValues, func() *func() float64 { return new(func() float64) }) = fn
+}
+
+func (g *GaugeFuncVec) write(w io.Writer) {
+	g.writeHeader(w)
+	g.each(func(labels string, fn *func() float64) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, labels, formatFloat((*fn)()))
+	})
+}
+
+// histogram is a single series of a histogram family.
+type histogram struct {
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec is a family of histograms sharing the same buckets.
+type HistogramVec struct {
+	*family[histogram]
+	buckets []float64
+}
+
+// NewHistogramVec creates and registers a histogram family with the given upper bucket bounds.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	h := &HistogramVec{family: newFamily[histogram](name, help, "histogram", labels), buckets: sorted}
+	r.register(h)
+	return h
+}
+
+// Observe records x in the histogram with the given label values.
+func (h *HistogramVec) Observe(x float64, labelValues ...string) {
+	s := h.get(labelValues, func() *histogram { return &histogram{counts: make([]uint64, len(h.buckets))} })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, bound := range h.buckets {
+		if x <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += x
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.writeHeader(w)
+	h.each(func(labels string, s *histogram) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, withLabel(labels, "le", formatFloat(bound)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, withLabel(labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, s.count)
+	})
+}
+
+// formatLabels renders label pairs as {name="value",...}.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, escapeLabel(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel appends a label pair to rendered labels.
+func withLabel(labels, name, value string) string {
+	pair := fmt.Sprintf(`%s="%s"`, name, value)
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+func formatFloat(x float64) string {
+	switch {
+	case math.IsInf(x, 1):
+		return "+Inf"
+	case math.IsInf(x, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	}
+}
+
+// escapeLabel escapes a label value for use between double quotes.
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// expose returns the exposition of r.
+func expose(r *Registry) string {
+	var b strings.Builder
+	r.Expose(&b)
+	return b.String()
+}
+
+func TestCounterVec(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("proxy_connections_total", "Connections accepted.\nPer \\ address.", "address", "kind")
+	c.Inc("b:25565", "login")
+	c.Add(2.5, "a:25565", `say "hi"`+"\n"+`C:\`)
+	c.Inc("b:25565", "login")
+
+	want := `# HELP proxy_connections_total Connections accepted.\nPer \\ address.
+# TYPE proxy_connections_total counter
+proxy_connections_total{address="a:25565",kind="say \"hi\"\nC:\\"} 2.5
+proxy_connections_total{address="b:25565",kind="login"} 2
+`
+	if got := expose(r); got != want {
+		t.Errorf("Expose() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGaugeVec(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGaugeVec("proxy_up", "Whether the proxy is up.")
+	g.Set(1)
+	g.Set(math.Inf(-1))
+
+	want := `# HELP proxy_up Whether the proxy is up.
+# TYPE proxy_up gauge
+proxy_up -Inf
+`
+	if got := expose(r); got != want {
+		t.Errorf("Expose() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGaugeFuncVec(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGaugeFuncVec("proxy_players", "Players online.", "address")
+	players := 0
+	g.Register(func() float64 { return float64(players) }, "crafty:25565")
+	g.Register(func() float64 { return 0.25 }, "crafty:25566")
+	players = 7
+
+	// Callbacks are read at scrape time.
+	want := `# HELP proxy_players Players online.
+# TYPE proxy_players gauge
+proxy_players{address="crafty:25565"} 7
+proxy_players{address="crafty:25566"} 0.25
+`
+	if got := expose(r); got != want {
+		t.Errorf("Expose() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	r := NewRegistry()
+	// Buckets are sorted, and counts are cumulative.
+	h := r.NewHistogramVec("proxy_start_seconds", "Server start duration.", []float64{60, 10, 30}, "address")
+	for _, x := range []float64{5, 10, 25, 45, 90} {
+		h.Observe(x, "crafty:25565")
+	}
+	plain := r.NewHistogramVec("proxy_ping_seconds", "Ping duration.", []float64{0.5})
+	plain.Observe(0.25)
+
+	want := `# HELP proxy_start_seconds Server start duration.
+# TYPE proxy_start_seconds histogram
+proxy_start_seconds_bucket{address="crafty:25565",le="10"} 2
+proxy_start_seconds_bucket{address="crafty:25565",le="30"} 3
+proxy_start_seconds_bucket{address="crafty:25565",le="60"} 4
+proxy_start_seconds_bucket{address="crafty:25565",le="+Inf"} 5
+proxy_start_seconds_sum{address="crafty:25565"} 175
+proxy_start_seconds_count{address="crafty:25565"} 5
+# HELP proxy_ping_seconds Ping duration.
+# TYPE proxy_ping_seconds histogram
+proxy_ping_seconds_bucket{le="0.5"} 1
+proxy_ping_seconds_bucket{le="+Inf"} 1
+proxy_ping_seconds_sum 0.25
+proxy_ping_seconds_count 1
+`
+	if got := expose(r); got != want {
+		t.Errorf("Expose() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWithLabel(t *testing.T) {
+	tests := []struct {
+		labels string
+		want   string
+	}{
+		{labels: "", want: `{le="1"}`},
+		{labels: `{address="a"}`, want: `{address="a",le="1"}`},
+		{labels: `{address="a",kind="b"}`, want: `{address="a",kind="b",le="1"}`},
+	}
+	for _, tt := range tests {
+		if got := withLabel(tt.labels, "le", "1"); got != tt.want {
+			t.Errorf("withLabel(%q) = %s, want %s", tt.labels, got, tt.want)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("proxy_errors_total", "Errors.").Inc()
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if got := recorder.Header().Get("Content-Type"); got != contentType {
+		t.Errorf("Content-Type = %q, want %q", got, contentType)
+	}
+	if body := recorder.Body.String(); !strings.HasSuffix(body, "proxy_errors_total 1\n") {
+		t.Errorf("body = %q, want the counter", body)
+	}
+}
+
+func TestWrongLabelCountPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc() with a missing label value did not panic")
+		}
+	}()
+	NewRegistry().NewCounterVec("proxy_connections_total", "Connections.", "address").Inc()
+}
@@ -0,0 +1,226 @@
+package minecraft
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Packet IDs used during the handshaking and status phases.
+const (
+	// HandshakePacketID is the ID of the serverbound Handshake packet.
+	HandshakePacketID int32 = 0x00
+	// StatusRequestPacketID is the ID of the serverbound Status Request packet.
+	StatusRequestPacketID int32 = 0x00
+	// StatusResponsePacketID is the ID of the clientbound Status Response packet.
+	StatusResponsePacketID int32 = 0x00
+	// PingPacketID is the ID of the serverbound Ping Request and clientbound Pong Response packets.
+	PingPacketID int32 = 0x01
+)
+
+// NextState is the state requested by the client in the handshake.
+type NextState = int32
+
+const (
+	// NextStateStatus requests a server list ping.
+	NextStateStatus NextState = 1
+	// NextStateLogin requests a login.
+	NextStateLogin NextState = 2
+	// NextStateTransfer requests a login after a server transfer.
+	NextStateTransfer NextState = 3
+)
+
+// maxServerAddressLength is the maximum length of the server address field in the handshake.
+const maxServerAddressLength = 255 * 4
+
+// Handshake is the first packet sent by a Java Edition client.
+type Handshake struct {
+	ProtocolVersion int32     // Protocol version of the client
+	ServerAddress   string    // Hostname or IP the client used to connect
+	ServerPort      uint16    // Port the client used to connect
+	NextState       NextState // Requested next state (status, login or transfer)
+}
+
+// ParseHandshake decodes a Handshake packet.
+func ParseHandshake(p Packet) (Handshake, error) {
+	if p.ID != HandshakePacketID {
+		return Handshake{}, fmt.Errorf("%w: expected handshake, got id 0x%02x", ErrUnexpectedPacket, p.ID)
+	}
+
+	reader := newPayloadReader(p.Data)
+	var (
+		handshake Handshake
+		err       error
+	)
+	if handshake.ProtocolVersion, err = ReadVarInt(reader); err != nil {
+		return Handshake{}, fmt.Errorf("%w: protocol version: %v", ErrInvalidPacket, err)
+	}
+	if handshake.ServerAddress, err = reader.readString(maxServerAddressLength); err != nil {
+		return Handshake{}, fmt.Errorf("%w: server address: %v", ErrInvalidPacket, err)
+	}
+	if handshake.ServerPort, err = reader.readUint16(); err != nil {
+		return Handshake{}, fmt.Errorf("%w: server port: %v", ErrInvalidPacket, err)
+	}
+	if handshake.NextState, err = ReadVarInt(reader); err != nil {
+		return Handshake{}, fmt.Errorf("%w: next state: %v", ErrInvalidPacket, err)
+	}
+
+	return handshake, nil
+}
+
+// Marshal returns the handshake encoded as a packet.
+func (h Handshake) Marshal() Packet {
+	data := AppendVarInt(nil, h.ProtocolVersion)
+	data = AppendString(data, h.ServerAddress)
+	data = binary.BigEndian.AppendUint16(data, h.ServerPort)
+	data = AppendVarInt(data, h.NextState)
+	return Packet{ID: HandshakePacketID, Data: data}
+}
+
+// StatusVersion is the version section of a status response.
+type StatusVersion struct {
+	Name     string `json:"name"`     // Version label shown in the server list
+	Protocol int32  `json:"protocol"` // Protocol version number
+}
+
+// StatusPlayers is the players section of a status response.
+type StatusPlayers struct {
+	Max    int `json:"max"`    // Maximum number of players
+	Online int `json:"online"` // Number of players online
+}
+
+// Status is the JSON document returned in a Status Response packet.
+type Status struct {
+	Version     StatusVersion   `json:"version"`
+	Players     StatusPlayers   `json:"players"`
+	Description json.RawMessage `json:"description"`       // Chat component used as the MOTD
+	Favicon     string          `json:"favicon,omitempty"` // data:image/png;base64 encoded server icon
+}
+
+// NewStatusResponse returns a Status Response packet carrying status.
+func NewStatusResponse(status Status) (Packet, error) {
+	payload, err := json.Marshal(status)
+	if err != nil {
+		return Packet{}, err
+	}
+	return Packet{ID: StatusResponsePacketID, Data: AppendString(nil, string(payload))}, nil
+}
+
+// NewStatusRequest returns a Status Request packet.
+func NewStatusRequest() Packet {
+	return Packet{ID: StatusRequestPacketID}
+}
+
+// ParseStatusResponse decodes a Status Response packet.
+func ParseStatusResponse(p Packet) (Status, error) {
+	if p.ID != StatusResponsePacketID {
+		return Status{}, fmt.Errorf("%w: expected status response, got id 0x%02x", ErrUnexpectedPacket, p.ID)
+	}
+	payload, err := newPayloadReader(p.Data).readString(maxStringLength)
+	if err != nil {
+		return Status{}, fmt.Errorf("%w: status: %v", ErrInvalidPacket, err)
+	}
+	var status Status
+	if err := json.Unmarshal([]byte(payload), &status); err != nil {
+		return Status{}, fmt.Errorf("%w: status: %v", ErrInvalidPacket, err)
+	}
+	return status, nil
+}
+
+// ParsePing decodes a Ping Request packet and returns its payload.
+func ParsePing(p Packet) (int64, error) {
+	if p.ID != PingPacketID {
+		return 0, fmt.Errorf("%w: expected ping, got id 0x%02x", ErrUnexpectedPacket, p.ID)
+	}
+	payload, err := newPayloadReader(p.Data).readInt64()
+	if err != nil {
+		return 0, fmt.Errorf("%w: ping payload: %v", ErrInvalidPacket, err)
+	}
+	return payload, nil
+}
+
+// NewPong returns a Pong Response packet echoing payload.
+func NewPong(payload int64) Packet {
+	return Packet{ID: PingPacketID, Data: binary.BigEndian.AppendUint64(nil, uint64(payload))} //nolint:gosec
+}
+
+// TextComponent returns a plain chat component with the given text.
+func TextComponent(text string) json.RawMessage {
+	data, _ := json.Marshal(struct {
+		Text string `json:"text"`
+	}{Text: text})
+	return data
+}
+
+// ChatComponent converts a MOTD or message from the configuration into a chat component.
+// Values that are valid JSON objects or arrays are used verbatim, anything else becomes a
+// text component with '&' colour and formatting codes translated to '§'.
+func ChatComponent(text string) json.RawMessage {
+	trimmed := strings.TrimSpace(text)
+	if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+	return TextComponent(TranslateColorCodes(text))
+}
+
+// TranslateColorCodes replaces '&' colour and formatting codes (e.g. "&a", "&l") with the '§' prefix
+// understood by the client. Ampersands that are not followed by a valid code are left untouched.
+func TranslateColorCodes(text string) string {
+	var builder strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '&' && i+1 < len(runes) && strings.ContainsRune(colorCodes, unicode.ToLower(runes[i+1])) {
+			builder.WriteRune('§')
+			continue
+		}
+		builder.WriteRune(runes[i])
+	}
+	return builder.String()
+}
+
+// colorCodes lists the characters that are valid after a formatting code prefix.
+const colorCodes = "0123456789abcdefklmnor"
+
+// Packet IDs used during the login phase.
+const (
+	// LoginStartPacketID is the ID of the serverbound Login Start packet.
+	LoginStartPacketID int32 = 0x00
+	// LoginDisconnectPacketID is the ID of the clientbound Disconnect (login) packet.
+	LoginDisconnectPacketID int32 = 0x00
+	// EncryptionRequestPacketID is the ID of the clientbound Encryption Request packet.
+	// Everything following the client's answer is encrypted.
+	EncryptionRequestPacketID int32 = 0x01
+	// LoginSuccessPacketID is the ID of the clientbound Login Success packet, which ends the login phase.
+	LoginSuccessPacketID int32 = 0x02
+	// SetCompressionPacketID is the ID of the clientbound Set Compression packet.
+	// Every following packet carries the length of its uncompressed data.
+	SetCompressionPacketID int32 = 0x03
+)
+
+// maxPlayerNameLength is the maximum length of the player name field in Login Start.
+const maxPlayerNameLength = 16 * 4
+
+// LoginStart is the first packet sent by the client in the login phase.
+type LoginStart struct {
+	Name string // Player name
+}
+
+// ParseLoginStart decodes a Login Start packet. Fields following the player name
+// differ between protocol versions and are ignored.
+func ParseLoginStart(p Packet) (LoginStart, error) {
+	if p.ID != LoginStartPacketID {
+		return LoginStart{}, fmt.Errorf("%w: expected login start, got id 0x%02x", ErrUnexpectedPacket, p.ID)
+	}
+	name, err := newPayloadReader(p.Data).readString(maxPlayerNameLength)
+	if err != nil {
+		return LoginStart{}, fmt.Errorf("%w: player name: %v", ErrInvalidPacket, err)
+	}
+	return LoginStart{Name: name}, nil
+}
+
+// NewLoginDisconnect returns a Disconnect (login) packet with the given chat component as the reason.
+func NewLoginDisconnect(reason json.RawMessage) Packet {
+	return Packet{ID: LoginDisconnectPacketID, Data: AppendString(nil, string(reason))}
+}
@@ -0,0 +1,138 @@
+package minecraft
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestHandshakeRoundTrip(t *testing.T) {
+	want := Handshake{ProtocolVersion: 767, ServerAddress: "survival.example.com", ServerPort: 25565, NextState: NextStateLogin}
+
+	var buf bytes.Buffer
+	if err := WritePacket(&buf, want.Marshal()); err != nil {
+		t.Fatalf("WritePacket() error = %v", err)
+	}
+	packet, err := ReadPacket(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("ReadPacket() error = %v", err)
+	}
+	got, err := ParseHandshake(packet)
+	if err != nil {
+		t.Fatalf("ParseHandshake() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("ParseHandshake() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseHandshakeRejectsMalformed(t *testing.T) {
+	valid := Handshake{ProtocolVersion: 767, ServerAddress: "localhost", ServerPort: 25565, NextState: NextStateStatus}.Marshal()
+
+	tests := []struct {
+		name    string
+		packet  Packet
+		wantErr error
+	}{
+		{name: "wrong packet", packet: Packet{ID: 0x01, Data: valid.Data}, wantErr: ErrUnexpectedPacket},
+		{name: "empty", packet: Packet{ID: HandshakePacketID}, wantErr: ErrInvalidPacket},
+		{name: "truncated address", packet: Packet{ID: HandshakePacketID, Data: valid.Data[:5]}, wantErr: ErrInvalidPacket},
+		{name: "missing port", packet: Packet{ID: HandshakePacketID, Data: valid.Data[:len(valid.Data)-3]}, wantErr: ErrInvalidPacket},
+		{name: "missing next state", packet: Packet{ID: HandshakePacketID, Data: valid.Data[:len(valid.Data)-1]}, wantErr: ErrInvalidPacket},
+		{
+			name:    "address too long",
+			packet:  Handshake{ServerAddress: string(bytes.Repeat([]byte{'a'}, maxServerAddressLength+1))}.Marshal(),
+			wantErr: ErrInvalidPacket,
+		},
+	}
+	for _, tt := range tests {
+		if _, err := ParseHandshake(tt.packet); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: ParseHandshake() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestStatusResponseRoundTrip(t *testing.T) {
+	want := Status{
+		Version:     StatusVersion{Name: "Sleeping", Protocol: -1},
+		Players:     StatusPlayers{Max: 20, Online: 0},
+		Description: TextComponent("Join to start"),
+	}
+	packet, err := NewStatusResponse(want)
+	if err != nil {
+		t.Fatalf("NewStatusResponse() error = %v", err)
+	}
+
+	got, err := ParseStatusResponse(packet)
+	if err != nil {
+		t.Fatalf("ParseStatusResponse() error = %v", err)
+	}
+	if got.Version != want.Version || got.Players != want.Players || !bytes.Equal(got.Description, want.Description) {
+		t.Errorf("ParseStatusResponse() = %+v, want %+v", got, want)
+	}
+
+	if _, err := ParseStatusResponse(Packet{ID: StatusResponsePacketID, Data: AppendString(nil, "{")}); !errors.Is(err, ErrInvalidPacket) {
+		t.Errorf("ParseStatusResponse() of invalid JSON error = %v, want %v", err, ErrInvalidPacket)
+	}
+	if _, err := ParseStatusResponse(Packet{ID: PingPacketID}); !errors.Is(err, ErrUnexpectedPacket) {
+		t.Errorf("ParseStatusResponse() of a ping error = %v, want %v", err, ErrUnexpectedPacket)
+	}
+}
+
+func TestPingPong(t *testing.T) {
+	pong := NewPong(-42)
+	payload, err := ParsePing(pong)
+	if err != nil {
+		t.Fatalf("ParsePing() error = %v", err)
+	}
+	if payload != -42 {
+		t.Errorf("ParsePing() = %d, want %d", payload, -42)
+	}
+
+	if _, err := ParsePing(Packet{ID: PingPacketID, Data: pong.Data[:7]}); !errors.Is(err, ErrInvalidPacket) {
+		t.Errorf("ParsePing() of a truncated payload error = %v, want %v", err, ErrInvalidPacket)
+	}
+	if _, err := ParsePing(NewStatusRequest()); !errors.Is(err, ErrUnexpectedPacket) {
+		t.Errorf("ParsePing() of a status request error = %v, want %v", err, ErrUnexpectedPacket)
+	}
+}
+
+func TestParseLoginStart(t *testing.T) {
+	// Fields following the name, here the player UUID, are ignored.
+	packet := Packet{ID: LoginStartPacketID, Data: append(AppendString(nil, "Notch"), make([]byte, 16)...)}
+	got, err := ParseLoginStart(packet)
+	if err != nil {
+		t.Fatalf("ParseLoginStart() error = %v", err)
+	}
+	if got.Name != "Notch" {
+		t.Errorf("ParseLoginStart() name = %q, want %q", got.Name, "Notch")
+	}
+
+	tooLong := Packet{ID: LoginStartPacketID, Data: AppendString(nil, string(bytes.Repeat([]byte{'a'}, maxPlayerNameLength+1)))}
+	if _, err := ParseLoginStart(tooLong); !errors.Is(err, ErrInvalidPacket) {
+		t.Errorf("ParseLoginStart() of a long name error = %v, want %v", err, ErrInvalidPacket)
+	}
+}
+
+func TestChatComponent(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "&aGreen &lbold", want: `{"text":"§aGreen §lbold"}`},
+		{text: `{"text":"raw","color":"red"}`, want: `{"text":"raw","color":"red"}`},
+		{text: "{not json", want: `{"text":"{not json"}`},
+	}
+	for _, tt := range tests {
+		if got := string(ChatComponent(tt.text)); got != tt.want {
+			t.Errorf("ChatComponent(%q) = %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTranslateColorCodes(t *testing.T) {
+	if got := TranslateColorCodes("&6Gold &Rreset & Tom &z"); got != "§6Gold §Rreset & Tom &z" {
+		t.Errorf("TranslateColorCodes() = %q, want %q", got, "§6Gold §Rreset & Tom &z")
+	}
+}
@@ -0,0 +1,206 @@
+// Package minecraft implements the subset of the Minecraft Java Edition protocol
+// needed by the proxy: VarInts, strings and the handshake, status and login packets.
+package minecraft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// maxVarIntBytes is the maximum number of bytes a VarInt can occupy.
+	maxVarIntBytes = 5
+	// MaxPacketLength caps the size of a packet accepted from a peer before compression is negotiated.
+	MaxPacketLength = 2 * 1024 * 1024
+	// MaxHandshakeLength caps the size of the packets a client sends before it is connected to the server:
+	// the handshake, login start and status packets, which are all far smaller.
+	MaxHandshakeLength = 4 * 1024
+	// legacyPingID is the first byte of the server list ping sent by clients before 1.7.
+	legacyPingID = 0xFE
+	// maxStringLength is the maximum length of a protocol string in UTF-16 code units times four,
+	// which bounds the JSON document of a Status Response packet as well.
+	maxStringLength = 32767 * 4
+)
+
+// legacyPingPrefix starts the server list ping sent by clients before 1.7.
+var legacyPingPrefix = []byte{legacyPingID, 0x01, 0xFA}
+
+var (
+	// ErrVarIntTooBig is returned when a VarInt exceeds five bytes.
+	ErrVarIntTooBig = errors.New("varint is too big")
+
+	// ErrPacketTooBig is returned when a packet length exceeds the maximum length.
+	ErrPacketTooBig = errors.New("packet is too big")
+
+	// ErrInvalidPacket is returned when a packet is malformed or truncated.
+	ErrInvalidPacket = errors.New("invalid packet")
+
+	// ErrUnexpectedPacket is returned when a packet with an unexpected ID is received.
+	ErrUnexpectedPacket = errors.New("unexpected packet")
+
+	// ErrLegacyPing is returned when a client sends the server list ping of versions before 1.7.
+	ErrLegacyPing = errors.New("legacy server list ping")
+)
+
+// Reader is the source packets are read from.
+type Reader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// Packet is a single uncompressed Minecraft packet.
+type Packet struct {
+	ID   int32  // Packet ID
+	Data []byte // Packet payload without the ID
+}
+
+// ReadVarInt reads a protocol VarInt from r.
+func ReadVarInt(r io.ByteReader) (int32, error) {
+	var value uint32
+	for i := 0; i < maxVarIntBytes; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint32(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(value), nil //nolint:gosec
+		}
+	}
+	return 0, ErrVarIntTooBig
+}
+
+// AppendVarInt appends the VarInt encoding of v to b.
+func AppendVarInt(b []byte, v int32) []byte {
+	value := uint32(v) //nolint:gosec
+	for value >= 0x80 {
+		b = append(b, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(b, byte(value))
+}
+
+// AppendString appends a VarInt length-prefixed string to b.
+func AppendString(b []byte, s string) []byte {
+	b = AppendVarInt(b, int32(len(s))) //nolint:gosec
+	return append(b, s...)
+}
+
+// ReadPacket reads a single length-prefixed packet of up to MaxPacketLength bytes from r.
+func ReadPacket(r Reader) (Packet, error) {
+	return ReadPacketLimit(r, MaxPacketLength)
+}
+
+// ReadPacketLimit reads a single length-prefixed packet from r, rejecting packets longer than maxLength
+// before reading them.
+func ReadPacketLimit(r Reader, maxLength int32) (Packet, error) {
+	length, err := ReadVarInt(r)
+	if err != nil {
+		return Packet{}, err
+	}
+	if length <= 0 {
+		return Packet{}, fmt.Errorf("%w: length %d", ErrInvalidPacket, length)
+	}
+	if length > maxLength {
+		return Packet{}, fmt.Errorf("%w: length %d", ErrPacketTooBig, length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return Packet{}, err
+	}
+
+	reader := newPayloadReader(body)
+	id, err := ReadVarInt(reader)
+	if err != nil {
+		return Packet{}, fmt.Errorf("%w: %v", ErrInvalidPacket, err)
+	}
+
+	return Packet{ID: id, Data: reader.rest()}, nil
+}
+
+// IsLegacyPing reports whether data, the start of what a client sent, is the server list ping of a client
+// before 1.7 rather than a packet. The ping starts with 0xFE 0x01 0xFA, while a packet whose length starts
+// with 0xFE 0x01 continues with the packet ID 0x00. decided is false while data is too short to tell them
+// apart, so the caller has to wait for more bytes.
+func IsLegacyPing(data []byte) (legacy, decided bool) {
+	n := min(len(data), len(legacyPingPrefix))
+	if !bytes.Equal(data[:n], legacyPingPrefix[:n]) {
+		return false, true
+	}
+	complete := n == len(legacyPingPrefix)
+	return complete, complete
+}
+
+// WritePacket writes p to w as a length-prefixed packet.
+func WritePacket(w io.Writer, p Packet) error {
+	_, err := w.Write(p.Marshal())
+	return err
+}
+
+// Marshal returns the wire encoding of the packet, including its length prefix.
+func (p Packet) Marshal() []byte {
+	body := AppendVarInt(nil, p.ID)
+	body = append(body, p.Data...)
+
+	out := AppendVarInt(make([]byte, 0, len(body)+maxVarIntBytes), int32(len(body))) //nolint:gosec
+	return append(out, body...)
+}
+
+// payloadReader decodes protocol fields from a packet payload.
+type payloadReader struct {
+	data []byte
+	pos  int
+}
+
+func newPayloadReader(data []byte) *payloadReader {
+	return &payloadReader{data: data}
+}
+
+// ReadByte implements io.ByteReader.
+func (r *payloadReader) ReadByte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *payloadReader) readString(maxLen int) (string, error) {
+	length, err := ReadVarInt(r)
+	if err != nil {
+		return "", err
+	}
+	if length < 0 || int(length) > maxLen || r.pos+int(length) > len(r.data) {
+		return "", fmt.Errorf("%w: string length %d", ErrInvalidPacket, length)
+	}
+	s := string(r.data[r.pos : r.pos+int(length)])
+	r.pos += int(length)
+	return s, nil
+}
+
+func (r *payloadReader) readUint16() (uint16, error) {
+	if r.pos+2 > len(r.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	v := binary.BigEndian.Uint16(r.data[r.pos:])
+	r.pos += 2
+	return v, nil
+}
+
+func (r *payloadReader) readInt64() (int64, error) {
+	if r.pos+8 > len(r.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	v := binary.BigEndian.Uint64(r.data[r.pos:])
+	r.pos += 8
+	return int64(v), nil //nolint:gosec
+}
+
+func (r *payloadReader) rest() []byte {
+	return r.data[r.pos:]
+}
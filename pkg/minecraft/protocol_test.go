@@ -0,0 +1,141 @@
+package minecraft
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestVarInt(t *testing.T) {
+	tests := []struct {
+		value   int32
+		encoded []byte
+	}{
+		{value: 0, encoded: []byte{0x00}},
+		{value: 1, encoded: []byte{0x01}},
+		{value: 127, encoded: []byte{0x7f}},
+		{value: 128, encoded: []byte{0x80, 0x01}},
+		{value: 255, encoded: []byte{0xff, 0x01}},
+		{value: 25565, encoded: []byte{0xdd, 0xc7, 0x01}},
+		{value: 2097151, encoded: []byte{0xff, 0xff, 0x7f}},
+		{value: 2147483647, encoded: []byte{0xff, 0xff, 0xff, 0xff, 0x07}},
+		{value: -1, encoded: []byte{0xff, 0xff, 0xff, 0xff, 0x0f}},
+		{value: -2147483648, encoded: []byte{0x80, 0x80, 0x80, 0x80, 0x08}},
+	}
+	for _, tt := range tests {
+		if got := AppendVarInt(nil, tt.value); !bytes.Equal(got, tt.encoded) {
+			t.Errorf("AppendVarInt(%d) = % x, want % x", tt.value, got, tt.encoded)
+		}
+		got, err := ReadVarInt(bytes.NewReader(tt.encoded))
+		if err != nil {
+			t.Fatalf("ReadVarInt(% x) error = %v", tt.encoded, err)
+		}
+		if got != tt.value {
+			t.Errorf("ReadVarInt(% x) = %d, want %d", tt.encoded, got, tt.value)
+		}
+	}
+}
+
+func TestReadVarIntRejectsMalformed(t *testing.T) {
+	if _, err := ReadVarInt(bytes.NewReader([]byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x01})); !errors.Is(err, ErrVarIntTooBig) {
+		t.Errorf("ReadVarInt() of six bytes error = %v, want %v", err, ErrVarIntTooBig)
+	}
+	if _, err := ReadVarInt(bytes.NewReader([]byte{0x80, 0x80})); !errors.Is(err, io.EOF) {
+		t.Errorf("ReadVarInt() of a truncated VarInt error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestString(t *testing.T) {
+	encoded := AppendString(nil, "mc.example.com")
+	if encoded[0] != byte(len("mc.example.com")) {
+		t.Fatalf("length prefix = %d, want %d", encoded[0], len("mc.example.com"))
+	}
+
+	got, err := newPayloadReader(encoded).readString(maxStringLength)
+	if err != nil {
+		t.Fatalf("readString() error = %v", err)
+	}
+	if got != "mc.example.com" {
+		t.Errorf("readString() = %q, want %q", got, "mc.example.com")
+	}
+
+	if _, err := newPayloadReader(encoded).readString(4); !errors.Is(err, ErrInvalidPacket) {
+		t.Errorf("readString() of a too long string error = %v, want %v", err, ErrInvalidPacket)
+	}
+	if _, err := newPayloadReader(encoded[:5]).readString(maxStringLength); !errors.Is(err, ErrInvalidPacket) {
+		t.Errorf("readString() of a truncated string error = %v, want %v", err, ErrInvalidPacket)
+	}
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	want := Packet{ID: 0x2a, Data: bytes.Repeat([]byte{0x55}, 300)}
+	var buf bytes.Buffer
+	if err := WritePacket(&buf, want); err != nil {
+		t.Fatalf("WritePacket() error = %v", err)
+	}
+
+	got, err := ReadPacket(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("ReadPacket() error = %v", err)
+	}
+	if got.ID != want.ID || !bytes.Equal(got.Data, want.Data) {
+		t.Errorf("ReadPacket() = {ID: %#x, %d bytes}, want {ID: %#x, %d bytes}", got.ID, len(got.Data), want.ID, len(want.Data))
+	}
+}
+
+func TestReadPacketRejectsMalformed(t *testing.T) {
+	withLength := func(length int32, rest ...byte) []byte {
+		return append(AppendVarInt(nil, length), rest...)
+	}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		maxLength int32
+		wantErr   error
+	}{
+		{name: "zero length", data: withLength(0), maxLength: MaxPacketLength, wantErr: ErrInvalidPacket},
+		{name: "negative length", data: withLength(-1), maxLength: MaxPacketLength, wantErr: ErrInvalidPacket},
+		{name: "longer than the maximum", data: withLength(MaxPacketLength + 1), maxLength: MaxPacketLength, wantErr: ErrPacketTooBig},
+		{name: "longer than a handshake", data: withLength(MaxHandshakeLength + 1), maxLength: MaxHandshakeLength, wantErr: ErrPacketTooBig},
+		{name: "truncated body", data: withLength(10, 0x00, 0x01), maxLength: MaxPacketLength, wantErr: io.ErrUnexpectedEOF},
+		{name: "bad packet ID", data: withLength(1, 0x80), maxLength: MaxPacketLength, wantErr: ErrInvalidPacket},
+		{name: "empty", data: nil, maxLength: MaxPacketLength, wantErr: io.EOF},
+	}
+	for _, tt := range tests {
+		if _, err := ReadPacketLimit(bufio.NewReader(bytes.NewReader(tt.data)), tt.maxLength); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: ReadPacketLimit() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestIsLegacyPing(t *testing.T) {
+	// A handshake of 254 bytes starts with the same length byte as the legacy ping.
+	handshake := Handshake{ProtocolVersion: 767, ServerAddress: string(bytes.Repeat([]byte{'a'}, 246)), ServerPort: 25565, NextState: NextStateLogin}
+	marshaled := handshake.Marshal().Marshal()
+	if marshaled[0] != legacyPingID {
+		t.Fatalf("handshake starts with %#x, want %#x", marshaled[0], legacyPingID)
+	}
+
+	tests := []struct {
+		name        string
+		data        []byte
+		want        bool
+		wantDecided bool
+	}{
+		{name: "1.6 ping", data: []byte{0xfe, 0x01, 0xfa, 0x00, 0x0b}, want: true, wantDecided: true},
+		{name: "1.6 ping prefix", data: []byte{0xfe, 0x01, 0xfa}, want: true, wantDecided: true},
+		{name: "first byte only", data: []byte{0xfe}},
+		{name: "first two bytes only", data: []byte{0xfe, 0x01}},
+		{name: "handshake", data: Handshake{ServerAddress: "localhost", NextState: NextStateStatus}.Marshal().Marshal(), wantDecided: true},
+		{name: "handshake with a legacy ping length", data: marshaled, wantDecided: true},
+		{name: "nothing received", data: nil},
+	}
+	for _, tt := range tests {
+		if got, decided := IsLegacyPing(tt.data); got != tt.want || decided != tt.wantDecided {
+			t.Errorf("%s: IsLegacyPing() = %t, %t, want %t, %t", tt.name, got, decided, tt.want, tt.wantDecided)
+		}
+	}
+}
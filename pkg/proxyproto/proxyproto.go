@@ -0,0 +1,240 @@
+// Package proxyproto implements reading and writing HAProxy PROXY protocol headers (v1 and v2),
+// which carry the original client address across TCP proxies.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Version is a PROXY protocol version.
+type Version = string
+
+const (
+	// V1 is the human-readable PROXY protocol version 1.
+	V1 Version = "v1"
+	// V2 is the binary PROXY protocol version 2.
+	V2 Version = "v2"
+)
+
+const (
+	// v1Prefix starts every version 1 header.
+	v1Prefix = "PROXY "
+	// v1MaxLength is the maximum length of a version 1 header including CRLF.
+	v1MaxLength = 107
+
+	// Version 2 commands: PROXY carries addresses, LOCAL is a health check by the proxy itself.
+	v2CommandProxy = 0x21
+	v2CommandLocal = 0x20
+
+	// Version 2 address family and transport bytes.
+	v2FamilyUnspec = 0x00
+	v2FamilyTCP4   = 0x11
+	v2FamilyTCP6   = 0x21
+
+	// Version 2 address block lengths.
+	v2AddrLengthTCP4 = 12
+	v2AddrLengthTCP6 = 36
+)
+
+// v2Signature starts every version 2 header.
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var (
+	// ErrNoHeader is returned when a connection does not start with a PROXY protocol header.
+	ErrNoHeader = errors.New("no PROXY protocol header")
+
+	// ErrInvalidHeader is returned when a PROXY protocol header is malformed.
+	ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+
+	// ErrUnsupportedVersion is returned when an unknown PROXY protocol version is requested.
+	ErrUnsupportedVersion = errors.New("unsupported PROXY protocol version")
+)
+
+// Header holds the addresses carried by a PROXY protocol header.
+// Both addresses are nil for LOCAL and UNKNOWN headers, meaning the connection's own addresses apply.
+type Header struct {
+	Source      net.Addr // Original client address
+	Destination net.Addr // Original destination address
+}
+
+// ReadHeader reads a version 1 or version 2 header from r, detecting the version automatically.
+func ReadHeader(r *bufio.Reader) (Header, error) {
+	prefix, err := r.Peek(len(v1Prefix))
+	if err != nil {
+		return Header{}, fmt.Errorf("%w: %v", ErrNoHeader, err)
+	}
+	if string(prefix) == v1Prefix {
+		return readV1(r)
+	}
+
+	prefix, err = r.Peek(len(v2Signature))
+	if err != nil || !bytes.Equal(prefix, v2Signature) {
+		return Header{}, ErrNoHeader
+	}
+	return readV2(r)
+}
+
+// readV1 reads a version 1 header like "PROXY TCP4 1.2.3.4 5.6.7.8 51234 25565\r\n".
+func readV1(r *bufio.Reader) (Header, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return Header{}, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+		}
+		line = append(line, b)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return Header{}, fmt.Errorf("%w: v1 header too long", ErrInvalidHeader)
+	}
+
+	fields := strings.Fields(strings.TrimSpace(string(line)))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return Header{}, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return Header{}, fmt.Errorf("%w: %q", ErrInvalidHeader, strings.TrimSpace(string(line)))
+	}
+
+	source, err := parseV1Addr(fields[2], fields[4])
+	if err != nil {
+		return Header{}, err
+	}
+	destination, err := parseV1Addr(fields[3], fields[5])
+	if err != nil {
+		return Header{}, err
+	}
+	return Header{Source: source, Destination: destination}, nil
+}
+
+func parseV1Addr(ip, port string) (*net.TCPAddr, error) {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return nil, fmt.Errorf("%w: bad address %q", ErrInvalidHeader, ip)
+	}
+	parsedPort, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad port %q", ErrInvalidHeader, port)
+	}
+	return &net.TCPAddr{IP: parsedIP, Port: int(parsedPort)}, nil
+}
+
+// readV2 reads a binary version 2 header. TLVs following the addresses are skipped.
+func readV2(r *bufio.Reader) (Header, error) {
+	fixed := make([]byte, len(v2Signature)+4)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return Header{}, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+	command := fixed[12]
+	family := fixed[13]
+	length := int(binary.BigEndian.Uint16(fixed[14:]))
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Header{}, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+
+	switch command {
+	case v2CommandLocal:
+		return Header{}, nil
+	case v2CommandProxy:
+	default:
+		return Header{}, fmt.Errorf("%w: v2 command 0x%02x", ErrInvalidHeader, command)
+	}
+
+	switch family {
+	case v2FamilyTCP4:
+		if length < v2AddrLengthTCP4 {
+			return Header{}, fmt.Errorf("%w: short v2 TCP4 address block", ErrInvalidHeader)
+		}
+		return Header{
+			Source:      &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:]))},
+			Destination: &net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:]))},
+		}, nil
+	case v2FamilyTCP6:
+		if length < v2AddrLengthTCP6 {
+			return Header{}, fmt.Errorf("%w: short v2 TCP6 address block", ErrInvalidHeader)
+		}
+		return Header{
+			Source:      &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:]))},
+			Destination: &net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:]))},
+		}, nil
+	default:
+		// Unsupported families (UDP, UNIX sockets) carry no address the proxy can use.
+		return Header{}, nil
+	}
+}
+
+// WriteHeader writes a header of the given version carrying source and destination to w.
+// If either address is not a TCP address, a header without addresses is written.
+func WriteHeader(w io.Writer, version Version, source, destination net.Addr) error {
+	var header []byte
+	switch version {
+	case V1:
+		header = marshalV1(source, destination)
+	case V2:
+		header = marshalV2(source, destination)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedVersion, version)
+	}
+	_, err := w.Write(header)
+	return err
+}
+
+func marshalV1(source, destination net.Addr) []byte {
+	src, srcOK := source.(*net.TCPAddr)
+	dst, dstOK := destination.(*net.TCPAddr)
+	if !srcOK || !dstOK {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+
+	if srcIP, dstIP := src.IP.To4(), dst.IP.To4(); srcIP != nil && dstIP != nil {
+		return fmt.Appendf(nil, "PROXY TCP4 %s %s %d %d\r\n", srcIP, dstIP, src.Port, dst.Port)
+	}
+
+	// Both addresses of a TCP6 header must be IPv6, so an IPv4 address next to an IPv6 one is mapped.
+	srcIP, dstIP := src.IP.To16(), dst.IP.To16()
+	if srcIP == nil || dstIP == nil {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+	return fmt.Appendf(nil, "PROXY TCP6 %s %s %d %d\r\n",
+		netip.AddrFrom16([16]byte(srcIP)), netip.AddrFrom16([16]byte(dstIP)), src.Port, dst.Port)
+}
+
+func marshalV2(source, destination net.Addr) []byte {
+	header := append([]byte{}, v2Signature...)
+
+	src, srcOK := source.(*net.TCPAddr)
+	dst, dstOK := destination.(*net.TCPAddr)
+	if !srcOK || !dstOK || src.IP.To16() == nil || dst.IP.To16() == nil {
+		header = append(header, v2CommandLocal, v2FamilyUnspec)
+		return binary.BigEndian.AppendUint16(header, 0)
+	}
+
+	srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+	if srcIP != nil && dstIP != nil {
+		header = append(header, v2CommandProxy, v2FamilyTCP4)
+		header = binary.BigEndian.AppendUint16(header, v2AddrLengthTCP4)
+	} else {
+		// An IPv4 address next to an IPv6 one is sent in its IPv4-mapped form.
+		srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+		header = append(header, v2CommandProxy, v2FamilyTCP6)
+		header = binary.BigEndian.AppendUint16(header, v2AddrLengthTCP6)
+	}
+	header = append(header, srcIP...)
+	header = append(header, dstIP...)
+	header = binary.BigEndian.AppendUint16(header, uint16(src.Port)) //nolint:gosec
+	return binary.BigEndian.AppendUint16(header, uint16(dst.Port))   //nolint:gosec
+}
@@ -0,0 +1,134 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func tcpAddr(ip string, port int) *net.TCPAddr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: port}
+}
+
+func TestHeaderRoundTrip(t *testing.T) {
+	const stream = "handshake"
+	tests := []struct {
+		name        string
+		source      net.Addr
+		destination net.Addr
+		wantV1      string
+	}{
+		{
+			name:        "IPv4",
+			source:      tcpAddr("203.0.113.7", 51234),
+			destination: tcpAddr("10.0.0.2", 25565),
+			wantV1:      "PROXY TCP4 203.0.113.7 10.0.0.2 51234 25565\r\n",
+		},
+		{
+			name:        "IPv6",
+			source:      tcpAddr("2001:db8::7", 51234),
+			destination: tcpAddr("2001:db8::2", 25565),
+			wantV1:      "PROXY TCP6 2001:db8::7 2001:db8::2 51234 25565\r\n",
+		},
+		{
+			name:        "IPv4 client on an IPv6 listener",
+			source:      tcpAddr("203.0.113.7", 51234),
+			destination: tcpAddr("2001:db8::2", 25565),
+			wantV1:      "PROXY TCP6 ::ffff:203.0.113.7 2001:db8::2 51234 25565\r\n",
+		},
+	}
+	for _, tt := range tests {
+		for _, version := range []Version{V1, V2} {
+			var buf bytes.Buffer
+			if err := WriteHeader(&buf, version, tt.source, tt.destination); err != nil {
+				t.Fatalf("%s %s: WriteHeader() error = %v", tt.name, version, err)
+			}
+			if version == V1 && buf.String() != tt.wantV1 {
+				t.Errorf("%s: v1 header = %q, want %q", tt.name, buf.String(), tt.wantV1)
+			}
+
+			// The connection continues right after the header.
+			buf.WriteString(stream)
+			reader := bufio.NewReader(&buf)
+			header, err := ReadHeader(reader)
+			if err != nil {
+				t.Fatalf("%s %s: ReadHeader() error = %v", tt.name, version, err)
+			}
+			assertAddr(t, tt.name+" "+version+" source", header.Source, tt.source)
+			assertAddr(t, tt.name+" "+version+" destination", header.Destination, tt.destination)
+			if rest, _ := reader.ReadString(0); rest != stream {
+				t.Errorf("%s %s: data after the header = %q, want %q", tt.name, version, rest, stream)
+			}
+		}
+	}
+}
+
+func assertAddr(t *testing.T, name string, got, want net.Addr) {
+	t.Helper()
+	gotTCP, ok := got.(*net.TCPAddr)
+	if !ok {
+		t.Fatalf("%s = %v, want %v", name, got, want)
+	}
+	wantTCP := want.(*net.TCPAddr)
+	if !gotTCP.IP.Equal(wantTCP.IP) || gotTCP.Port != wantTCP.Port {
+		t.Errorf("%s = %v, want %v", name, got, want)
+	}
+}
+
+func TestHeaderWithoutAddresses(t *testing.T) {
+	unix := &net.UnixAddr{Name: "/run/proxy.sock", Net: "unix"}
+	for _, version := range []Version{V1, V2} {
+		var buf bytes.Buffer
+		if err := WriteHeader(&buf, version, unix, tcpAddr("10.0.0.2", 25565)); err != nil {
+			t.Fatalf("%s: WriteHeader() error = %v", version, err)
+		}
+		header, err := ReadHeader(bufio.NewReader(&buf))
+		if err != nil {
+			t.Fatalf("%s: ReadHeader() error = %v", version, err)
+		}
+		if header.Source != nil || header.Destination != nil {
+			t.Errorf("%s: ReadHeader() = %+v, want no addresses", version, header)
+		}
+	}
+}
+
+func TestWriteHeaderUnsupportedVersion(t *testing.T) {
+	err := WriteHeader(&bytes.Buffer{}, "v3", tcpAddr("203.0.113.7", 1), tcpAddr("10.0.0.2", 2))
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("WriteHeader() error = %v, want %v", err, ErrUnsupportedVersion)
+	}
+}
+
+func TestReadHeaderRejectsMalformed(t *testing.T) {
+	v2 := func(command, family byte, length int, payload ...byte) string {
+		return string(v2Signature) + string([]byte{command, family, byte(length >> 8), byte(length)}) + string(payload) //nolint:gosec
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr error
+	}{
+		{name: "minecraft handshake", data: "\x10\x00\xff\x05\x09localhost\x63\xdd\x02", wantErr: ErrNoHeader},
+		{name: "empty", data: "", wantErr: ErrNoHeader},
+		{name: "v2 signature mismatch", data: "\r\n\r\n\x00\r\nQUIZ\n\x21\x11\x00\x00", wantErr: ErrNoHeader},
+		{name: "v1 unknown family", data: "PROXY UDP4 1.2.3.4 5.6.7.8 1 2\r\n", wantErr: ErrInvalidHeader},
+		{name: "v1 missing fields", data: "PROXY TCP4 1.2.3.4 5.6.7.8 1\r\n", wantErr: ErrInvalidHeader},
+		{name: "v1 bad address", data: "PROXY TCP4 1.2.3 5.6.7.8 1 2\r\n", wantErr: ErrInvalidHeader},
+		{name: "v1 bad port", data: "PROXY TCP4 1.2.3.4 5.6.7.8 1 65536\r\n", wantErr: ErrInvalidHeader},
+		{name: "v1 without CRLF", data: "PROXY TCP4 1.2.3.4 5.6.7.8 1 2", wantErr: ErrInvalidHeader},
+		{name: "v1 too long", data: "PROXY TCP6 " + strings.Repeat("f", v1MaxLength) + "\r\n", wantErr: ErrInvalidHeader},
+		{name: "v2 truncated header", data: string(v2Signature) + "\x21", wantErr: ErrInvalidHeader},
+		{name: "v2 truncated addresses", data: v2(v2CommandProxy, v2FamilyTCP4, v2AddrLengthTCP4, 1, 2, 3, 4), wantErr: ErrInvalidHeader},
+		{name: "v2 short address block", data: v2(v2CommandProxy, v2FamilyTCP4, 4, 1, 2, 3, 4), wantErr: ErrInvalidHeader},
+		{name: "v2 unknown command", data: v2(0x22, v2FamilyUnspec, 0), wantErr: ErrInvalidHeader},
+	}
+	for _, tt := range tests {
+		if _, err := ReadHeader(bufio.NewReader(strings.NewReader(tt.data))); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: ReadHeader() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
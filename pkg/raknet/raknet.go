@@ -0,0 +1,162 @@
+// Package raknet implements the offline (unconnected) RakNet messages used by Minecraft Bedrock Edition
+// for server discovery and connection setup.
+package raknet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Offline message IDs.
+const (
+	// UnconnectedPingID is sent by clients looking for servers.
+	UnconnectedPingID byte = 0x01
+	// UnconnectedPingOpenConnectionsID is sent by clients looking for servers with free slots.
+	UnconnectedPingOpenConnectionsID byte = 0x02
+	// OpenConnectionRequest1ID is the first packet of a RakNet connection attempt.
+	OpenConnectionRequest1ID byte = 0x05
+	// UnconnectedPongID is the reply to an unconnected ping.
+	UnconnectedPongID byte = 0x1c
+)
+
+// magic identifies offline RakNet messages.
+var magic = []byte{0x00, 0xff, 0xff, 0x00, 0xfe, 0xfe, 0xfe, 0xfe, 0xfd, 0xfd, 0xfd, 0xfd, 0x12, 0x34, 0x56, 0x78}
+
+const (
+	// pingLength is the length of an unconnected ping: ID, time, magic and client GUID.
+	pingLength = 1 + 8 + 16 + 8
+	// pongHeaderLength is the length of an unconnected pong before the server ID string.
+	pongHeaderLength = 1 + 8 + 8 + 16 + 2
+)
+
+var (
+	// ErrInvalidMessage is returned when an offline message is malformed.
+	ErrInvalidMessage = errors.New("invalid RakNet message")
+)
+
+// UnconnectedPing is a server discovery request.
+type UnconnectedPing struct {
+	Time       int64 // Client timestamp echoed in the pong
+	ClientGUID int64 // Client GUID
+}
+
+// UnconnectedPong is a server discovery reply.
+type UnconnectedPong struct {
+	Time       int64  // Timestamp from the ping
+	ServerGUID int64  // Server GUID
+	ServerID   string // Semicolon separated server description, see BedrockServerID
+}
+
+// IsPing reports whether the datagram is an unconnected ping.
+func IsPing(data []byte) bool {
+	return len(data) > 0 && (data[0] == UnconnectedPingID || data[0] == UnconnectedPingOpenConnectionsID)
+}
+
+// IsOpenConnectionRequest reports whether the datagram starts a RakNet connection.
+func IsOpenConnectionRequest(data []byte) bool {
+	return len(data) >= 1+len(magic) && data[0] == OpenConnectionRequest1ID && bytes.Equal(data[1:1+len(magic)], magic)
+}
+
+// ParsePing decodes an unconnected ping.
+func ParsePing(data []byte) (UnconnectedPing, error) {
+	if len(data) < pingLength || !IsPing(data) || !bytes.Equal(data[9:25], magic) {
+		return UnconnectedPing{}, ErrInvalidMessage
+	}
+	return UnconnectedPing{
+		Time:       int64(binary.BigEndian.Uint64(data[1:])),  //nolint:gosec
+		ClientGUID: int64(binary.BigEndian.Uint64(data[25:])), //nolint:gosec
+	}, nil
+}
+
+// Marshal encodes the ping.
+func (p UnconnectedPing) Marshal() []byte {
+	data := []byte{UnconnectedPingID}
+	data = binary.BigEndian.AppendUint64(data, uint64(p.Time)) //nolint:gosec
+	data = append(data, magic...)
+	return binary.BigEndian.AppendUint64(data, uint64(p.ClientGUID)) //nolint:gosec
+}
+
+// ParsePong decodes an unconnected pong.
+func ParsePong(data []byte) (UnconnectedPong, error) {
+	if len(data) < pongHeaderLength || data[0] != UnconnectedPongID || !bytes.Equal(data[17:33], magic) {
+		return UnconnectedPong{}, ErrInvalidMessage
+	}
+	length := int(binary.BigEndian.Uint16(data[33:]))
+	if len(data) < pongHeaderLength+length {
+		return UnconnectedPong{}, fmt.Errorf("%w: truncated server ID", ErrInvalidMessage)
+	}
+	return UnconnectedPong{
+		Time:       int64(binary.BigEndian.Uint64(data[1:])), //nolint:gosec
+		ServerGUID: int64(binary.BigEndian.Uint64(data[9:])), //nolint:gosec
+		ServerID:   string(data[pongHeaderLength : pongHeaderLength+length]),
+	}, nil
+}
+
+// Marshal encodes the pong.
+func (p UnconnectedPong) Marshal() []byte {
+	data := []byte{UnconnectedPongID}
+	data = binary.BigEndian.AppendUint64(data, uint64(p.Time))       //nolint:gosec
+	data = binary.BigEndian.AppendUint64(data, uint64(p.ServerGUID)) //nolint:gosec
+	data = append(data, magic...)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(p.ServerID))) //nolint:gosec
+	return append(data, p.ServerID...)
+}
+
+// BedrockStatus describes a Bedrock server in the server list.
+type BedrockStatus struct {
+	MOTD            string // First MOTD line
+	SubMOTD         string // Second MOTD line (world name)
+	ProtocolVersion int    // Bedrock network protocol version
+	VersionName     string // Version label shown in the server list
+	Online          int    // Number of players online
+	Max             int    // Maximum number of players
+	ServerGUID      int64  // Server GUID
+	PortV4          int    // IPv4 port
+	PortV6          int    // IPv6 port
+}
+
+// ServerID returns the semicolon separated server description carried by a Bedrock pong.
+func (s BedrockStatus) ServerID() string {
+	return fmt.Sprintf("MCPE;%s;%d;%s;%d;%d;%d;%s;Survival;1;%d;%d;",
+		s.MOTD, s.ProtocolVersion, s.VersionName, s.Online, s.Max, s.ServerGUID, s.SubMOTD, s.PortV4, s.PortV6)
+}
+
+// ParseServerID decodes the semicolon separated server description carried by a Bedrock pong.
+// Fields missing from the description are left empty.
+func ParseServerID(serverID string) (BedrockStatus, error) {
+	fields := strings.Split(serverID, ";")
+	if len(fields) < 6 {
+		return BedrockStatus{}, fmt.Errorf("%w: server id has %d fields", ErrInvalidMessage, len(fields))
+	}
+
+	var (
+		status BedrockStatus
+		err    error
+	)
+	status.MOTD = fields[1]
+	if status.ProtocolVersion, err = strconv.Atoi(fields[2]); err != nil {
+		return BedrockStatus{}, fmt.Errorf("%w: protocol version: %v", ErrInvalidMessage, err)
+	}
+	status.VersionName = fields[3]
+	if status.Online, err = strconv.Atoi(fields[4]); err != nil {
+		return BedrockStatus{}, fmt.Errorf("%w: online players: %v", ErrInvalidMessage, err)
+	}
+	if status.Max, err = strconv.Atoi(fields[5]); err != nil {
+		return BedrockStatus{}, fmt.Errorf("%w: max players: %v", ErrInvalidMessage, err)
+	}
+	if len(fields) > 6 {
+		status.ServerGUID, _ = strconv.ParseInt(fields[6], 10, 64)
+	}
+	if len(fields) > 7 {
+		status.SubMOTD = fields[7]
+	}
+	if len(fields) > 11 {
+		status.PortV4, _ = strconv.Atoi(fields[10])
+		status.PortV6, _ = strconv.Atoi(fields[11])
+	}
+	return status, nil
+}
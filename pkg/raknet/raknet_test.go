@@ -0,0 +1,137 @@
+package raknet
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestPingRoundTrip(t *testing.T) {
+	want := UnconnectedPing{Time: 123456789, ClientGUID: -7}
+	data := want.Marshal()
+	if len(data) != pingLength {
+		t.Fatalf("Marshal() length = %d, want %d", len(data), pingLength)
+	}
+	if !IsPing(data) {
+		t.Fatal("IsPing() = false for a marshaled ping")
+	}
+
+	got, err := ParsePing(data)
+	if err != nil {
+		t.Fatalf("ParsePing() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("ParsePing() = %+v, want %+v", got, want)
+	}
+
+	// Pings for servers with free slots differ only in the ID.
+	data[0] = UnconnectedPingOpenConnectionsID
+	if got, err := ParsePing(data); err != nil || got != want {
+		t.Errorf("ParsePing() of an open connections ping = %+v, %v, want %+v", got, err, want)
+	}
+}
+
+func TestPongRoundTrip(t *testing.T) {
+	want := UnconnectedPong{Time: 123456789, ServerGUID: 42, ServerID: "MCPE;Sleeping;712;1.21.20;0;10;42;Join to wake;Survival;1;19132;19133;"}
+	got, err := ParsePong(want.Marshal())
+	if err != nil {
+		t.Fatalf("ParsePong() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("ParsePong() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseRejectsMalformed(t *testing.T) {
+	ping := UnconnectedPing{Time: 1, ClientGUID: 2}.Marshal()
+	pong := UnconnectedPong{Time: 1, ServerGUID: 2, ServerID: "MCPE;motd;712;1.21.20;0;10;"}.Marshal()
+	badMagic := func(data []byte, offset int) []byte {
+		data = append([]byte(nil), data...)
+		data[offset] ^= 0xff
+		return data
+	}
+
+	pings := map[string][]byte{
+		"empty":           nil,
+		"truncated":       ping[:pingLength-1],
+		"bad magic":       badMagic(ping, 9),
+		"pong":            pong,
+		"connection open": append([]byte{OpenConnectionRequest1ID}, ping[1:]...),
+	}
+	for name, data := range pings {
+		if _, err := ParsePing(data); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("ParsePing() of %s error = %v, want %v", name, err, ErrInvalidMessage)
+		}
+	}
+
+	pongs := map[string][]byte{
+		"empty":               nil,
+		"truncated header":    pong[:pongHeaderLength-1],
+		"truncated server ID": pong[:len(pong)-1],
+		"bad magic":           badMagic(pong, 17),
+		"ping":                ping,
+	}
+	for name, data := range pongs {
+		if _, err := ParsePong(data); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("ParsePong() of %s error = %v, want %v", name, err, ErrInvalidMessage)
+		}
+	}
+}
+
+func TestIsOpenConnectionRequest(t *testing.T) {
+	// Protocol version and MTU padding follow the magic.
+	request := append(append([]byte{OpenConnectionRequest1ID}, magic...), append([]byte{11}, make([]byte, 1400)...)...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{name: "request", data: request, want: true},
+		{name: "truncated magic", data: request[:len(magic)]},
+		{name: "bad magic", data: append([]byte{OpenConnectionRequest1ID}, bytes.Repeat([]byte{0xfe}, 20)...)},
+		{name: "ping", data: UnconnectedPing{}.Marshal()},
+		{name: "empty", data: nil},
+	}
+	for _, tt := range tests {
+		if got := IsOpenConnectionRequest(tt.data); got != tt.want {
+			t.Errorf("%s: IsOpenConnectionRequest() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestServerID(t *testing.T) {
+	want := BedrockStatus{
+		MOTD:            "Sleeping",
+		SubMOTD:         "Join to wake",
+		ProtocolVersion: 712,
+		VersionName:     "1.21.20",
+		Online:          0,
+		Max:             10,
+		ServerGUID:      42,
+		PortV4:          19132,
+		PortV6:          19133,
+	}
+	got, err := ParseServerID(want.ServerID())
+	if err != nil {
+		t.Fatalf("ParseServerID() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("ParseServerID() = %+v, want %+v", got, want)
+	}
+
+	// Fields after the player counts are optional.
+	got, err = ParseServerID("MCPE;motd;712;1.21.20;3;10")
+	if err != nil {
+		t.Fatalf("ParseServerID() of a short server ID error = %v", err)
+	}
+	if got.Online != 3 || got.Max != 10 || got.ServerGUID != 0 {
+		t.Errorf("ParseServerID() of a short server ID = %+v", got)
+	}
+
+	for _, serverID := range []string{"MCPE;motd;712", "MCPE;motd;new;1.21.20;0;10", "MCPE;motd;712;1.21.20;zero;10"} {
+		if _, err := ParseServerID(serverID); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("ParseServerID(%q) error = %v, want %v", serverID, err, ErrInvalidMessage)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Package rcon implements a client for the Source RCON protocol spoken by Minecraft Java Edition servers.
+package rcon
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Packet types.
+const (
+	// typeResponse is the type of a command response.
+	typeResponse int32 = 0
+	// typeCommand is the type of a command request.
+	typeCommand int32 = 2
+	// typeAuthResponse is the type of an authentication response.
+	typeAuthResponse int32 = 2
+	// typeAuth is the type of an authentication request.
+	typeAuth int32 = 3
+)
+
+const (
+	// headerLength is the length of the request ID and type fields.
+	headerLength = 4 + 4
+	// maxPacketLength caps the size of a packet accepted from the server.
+	maxPacketLength = 4096 + headerLength + 2
+	// authFailedID is the request ID of an authentication response rejecting the password.
+	authFailedID int32 = -1
+)
+
+var (
+	// ErrAuthFailed is returned when the server rejects the RCON password.
+	ErrAuthFailed = errors.New("rcon authentication failed")
+
+	// ErrInvalidPacket is returned when a packet from the server is malformed.
+	ErrInvalidPacket = errors.New("invalid rcon packet")
+)
+
+// packet is a single RCON message.
+type packet struct {
+	id   int32
+	kind int32
+	body string
+}
+
+// Client is an authenticated RCON connection. It is not safe for concurrent use.
+type Client struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+	nextID  int32
+}
+
+// Dial connects to the RCON server at address and authenticates with password.
+// Every request, including the authentication, must complete within timeout.
+func Dial(address, password string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}
+	if err := c.authenticate(password); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Command runs a console command and returns its output.
+func (c *Client) Command(command string) (string, error) {
+	id, err := c.send(typeCommand, command)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := c.receive()
+	if err != nil {
+		return "", err
+	}
+	if response.id != id || response.kind != typeResponse {
+		return "", fmt.Errorf("%w: unexpected response id %d, type %d", ErrInvalidPacket, response.id, response.kind)
+	}
+	return response.body, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// authenticate logs in with password. Responses other than the authentication response are skipped,
+// as some servers send an empty response first.
+func (c *Client) authenticate(password string) error {
+	id, err := c.send(typeAuth, password)
+	if err != nil {
+		return err
+	}
+
+	for {
+		response, err := c.receive()
+		if err != nil {
+			return err
+		}
+		if response.kind != typeAuthResponse {
+			continue
+		}
+		if response.id == authFailedID || response.id != id {
+			return ErrAuthFailed
+		}
+		return nil
+	}
+}
+
+// send writes a packet with a new request ID and returns the ID.
+func (c *Client) send(kind int32, body string) (int32, error) {
+	c.nextID++
+	_ = c.conn.SetDeadline(time.Now().Add(c.timeout))
+
+	if _, err := c.conn.Write(packet{id: c.nextID, kind: kind, body: body}.marshal()); err != nil {
+		return 0, err
+	}
+	return c.nextID, nil
+}
+
+// receive reads a single packet.
+func (c *Client) receive() (packet, error) {
+	return readPacket(c.reader)
+}
+
+// marshal returns the wire encoding of the packet: its length, ID, type and the body
+// followed by two null bytes, all integers little-endian.
+func (p packet) marshal() []byte {
+	data := binary.LittleEndian.AppendUint32(nil, uint32(headerLength+len(p.body)+2)) //nolint:gosec
+	data = binary.LittleEndian.AppendUint32(data, uint32(p.id))                       //nolint:gosec
+	data = binary.LittleEndian.AppendUint32(data, uint32(p.kind))                     //nolint:gosec
+	data = append(data, p.body...)
+	return append(data, 0, 0)
+}
+
+// readPacket reads a single length-prefixed packet from r.
+func readPacket(r io.Reader) (packet, error) {
+	var length int32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return packet{}, err
+	}
+	if length < headerLength+2 || length > maxPacketLength {
+		return packet{}, fmt.Errorf("%w: length %d", ErrInvalidPacket, length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return packet{}, err
+	}
+	return packet{
+		id:   int32(binary.LittleEndian.Uint32(data[0:4])), //nolint:gosec
+		kind: int32(binary.LittleEndian.Uint32(data[4:8])), //nolint:gosec
+		body: string(data[headerLength : length-2]),
+	}, nil
+}
@@ -0,0 +1,148 @@
+package rcon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPacketRoundTrip(t *testing.T) {
+	tests := []packet{
+		{id: 1, kind: typeAuth, body: "secret"},
+		{id: 42, kind: typeCommand, body: "say Server shutting down in 1m0s"},
+		{id: 7, kind: typeResponse, body: ""},
+		{id: authFailedID, kind: typeAuthResponse, body: ""},
+	}
+	for _, want := range tests {
+		data := want.marshal()
+		if length := int(binary.LittleEndian.Uint32(data)); length != len(data)-4 {
+			t.Errorf("%q: length field = %d, want %d", want.body, length, len(data)-4)
+		}
+		if !bytes.HasSuffix(data, []byte{0, 0}) {
+			t.Errorf("%q: packet is not terminated by two null bytes", want.body)
+		}
+
+		got, err := readPacket(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%q: readPacket() error = %v", want.body, err)
+		}
+		if got != want {
+			t.Errorf("readPacket() = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestReadPacketRejectsMalformed(t *testing.T) {
+	withLength := func(length int32, rest ...byte) []byte {
+		return append(binary.LittleEndian.AppendUint32(nil, uint32(length)), rest...) //nolint:gosec
+	}
+	valid := packet{id: 1, kind: typeResponse, body: "output"}.marshal()
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{name: "shorter than the header", data: withLength(headerLength + 1), wantErr: ErrInvalidPacket},
+		{name: "negative length", data: withLength(-5), wantErr: ErrInvalidPacket},
+		{name: "longer than the maximum", data: withLength(maxPacketLength + 1), wantErr: ErrInvalidPacket},
+		{name: "truncated body", data: valid[:len(valid)-3], wantErr: io.ErrUnexpectedEOF},
+		{name: "truncated length", data: valid[:2], wantErr: io.ErrUnexpectedEOF},
+		{name: "empty", data: nil, wantErr: io.EOF},
+	}
+	for _, tt := range tests {
+		if _, err := readPacket(bytes.NewReader(tt.data)); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: readPacket() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+// serve runs a fake RCON server accepting a single connection and answering every request with respond.
+func serve(t *testing.T, respond func(request packet) []packet) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		for {
+			request, err := readPacket(reader)
+			if err != nil {
+				return
+			}
+			for _, response := range respond(request) {
+				if _, err := conn.Write(response.marshal()); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestDialAndCommand(t *testing.T) {
+	address := serve(t, func(request packet) []packet {
+		if request.kind == typeAuth {
+			// Some servers send an empty response before the authentication response.
+			return []packet{{id: request.id, kind: typeResponse}, {id: request.id, kind: typeAuthResponse}}
+		}
+		return []packet{{id: request.id, kind: typeResponse, body: "ran " + request.body}}
+	})
+
+	client, err := Dial(address, "secret", time.Second)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer client.Close()
+
+	output, err := client.Command("save-all")
+	if err != nil {
+		t.Fatalf("Command() error = %v", err)
+	}
+	if output != "ran save-all" {
+		t.Errorf("Command() = %q, want %q", output, "ran save-all")
+	}
+}
+
+func TestDialWrongPassword(t *testing.T) {
+	address := serve(t, func(packet) []packet {
+		return []packet{{id: authFailedID, kind: typeAuthResponse}}
+	})
+
+	if _, err := Dial(address, "wrong", time.Second); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("Dial() error = %v, want %v", err, ErrAuthFailed)
+	}
+}
+
+func TestCommandRejectsMismatchedResponse(t *testing.T) {
+	address := serve(t, func(request packet) []packet {
+		if request.kind == typeAuth {
+			return []packet{{id: request.id, kind: typeAuthResponse}}
+		}
+		return []packet{{id: request.id + 1, kind: typeResponse}}
+	})
+
+	client, err := Dial(address, "secret", time.Second)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Command("list"); !errors.Is(err, ErrInvalidPacket) {
+		t.Fatalf("Command() error = %v, want %v", err, ErrInvalidPacket)
+	}
+}